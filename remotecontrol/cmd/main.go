@@ -6,15 +6,20 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	_ "time/tzdata" // The container image has no zoneinfo, TZ needs it
 
 	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/bot"
-	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/epg"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/health"
 	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/playlist"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/queue"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/reconciler"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/scheduler"
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	b, err := bot.New()
 	if err != nil {
 		log.Fatal(err)
@@ -24,6 +29,38 @@ func main() {
 		playlist.UpdatePlaylist(ctx)
 	}
 
+	refresher, err := playlist.NewRefresher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go refresher.Run(ctx)
+
+	epgUpdater, err := epg.NewUpdater()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go epgUpdater.Run(ctx)
+
+	prober, err := health.NewProber()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go prober.Run(ctx)
+
+	reconcilerLoop, err := reconciler.NewReconciler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reconcilerLoop.Run(ctx)
+
+	go queue.Run(ctx)
+
+	sched, err := scheduler.NewScheduler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go sched.Run(ctx)
+
 	err = b.DiscordSession.Open()
 	if err != nil {
 		log.Println("error opening connection,", err)
@@ -31,36 +68,14 @@ func main() {
 	}
 
 	bot.AddCommands(b.DiscordSession)
+	go bot.WatchPanels(ctx, b.DiscordSession)
+	go bot.WatchNotices(ctx, b.DiscordSession)
 	log.Println("Discord Bot is now running.")
 
 	// Make channel to keep bot running and handle graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start a goroutine to check viewer status every minute
-	go func() {
-		ticker := time.NewTicker(120 * time.Second)
-		defer ticker.Stop()
-
-		r, err := models.NewAuthenticatedRedisClient(ctx)
-		if err != nil {
-			log.Panicf("Error creating redis client: %v\n", err)
-		}
-
-		for {
-			select {
-			case <-ticker.C:
-				isWatching := bot.IsAnyoneWatching(ctx, b.DiscordSession)
-				if !isWatching {
-					log.Println("No one is watching, stopping bot.")
-					r.Stop(ctx)
-				}
-			case <-stop:
-				return
-			}
-		}
-	}()
-
 	// Wait for signal to terminate
 	<-stop
 	log.Println("Gracefully shutting down...")
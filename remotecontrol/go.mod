@@ -6,6 +6,7 @@ require (
 	github.com/bwmarrin/discordgo v0.28.1
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/kkdai/youtube/v2 v2.10.2
+	golang.org/x/text v0.20.0
 )
 
 require (
@@ -19,5 +20,4 @@ require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
 	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/text v0.20.0 // indirect
 )
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// Discord accepts at most 25 choices of up to 100 characters
+const (
+	maxChoices       = 25
+	maxChoiceNameLen = 100
+)
+
+// autocompleteHandler suggests channels for the focused option of /tv,
+// /search, /fav and /schedule. Choices show "ID - NAME" and carry the channel
+// ID as value, except for /search where the channel name is the query to run
+// and for favorites, which carry the favorite key. /schedule also suggests
+// guide programmes and scheduled jobs.
+func autocompleteHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	data := i.ApplicationCommandData()
+
+	options := data.Options
+	subcommand := ""
+	if len(options) == 1 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		subcommand = options[0].Name
+		options = options[0].Options
+	}
+
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	scope, channel := "", ""
+	for _, option := range options {
+		if option.Focused {
+			focused = option
+		}
+		switch option.Name {
+		case "scope":
+			scope = option.StringValue()
+		case "channel":
+			channel = option.StringValue()
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if focused != nil {
+		query := strings.TrimSpace(focused.StringValue())
+		switch {
+		case data.Name == "fav" && subcommand != "add":
+			favScope, ownerID, _ := favoritesOwner(i, scope)
+			favorites, err := r.GetFavorites(ctx, favScope, ownerID)
+			if err != nil {
+				log.Printf("Error getting favorites: %v\n", err)
+			}
+			choices = favoritesChoices(favorites, query)
+		case data.Name == "schedule" && focused.Name == "job":
+			choices = scheduleChoices(ctx, r, query)
+		case data.Name == "schedule" && focused.Name == "programme":
+			choices = programmeChoices(ctx, r, query, channel)
+		case query != "":
+			channels, err := r.SearchChannelsByName(ctx, query)
+			if err != nil {
+				log.Printf("Error searching for channel: %v\n", err)
+			}
+			for _, channel := range channels {
+				if len(choices) == maxChoices {
+					break
+				}
+				value := channel.ID
+				if data.Name == "search" {
+					value = channel.Name
+				}
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  truncateChoiceName(fmt.Sprintf("%s - %s", channel.ID, channel.Name)),
+					Value: truncateChoiceName(value),
+				})
+			}
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to autocomplete: %v\n", err)
+	}
+}
+
+// resolveChannel finds a channel by ID or, when the value is not a number,
+// by name. An exact name match wins over the best search result.
+func resolveChannel(ctx context.Context, r *models.RedisStore, value string) (*models.TvChannel, error) {
+	value = strings.TrimSpace(value)
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return r.GetChannelByID(ctx, id)
+	}
+
+	channels, err := r.SearchChannelsByName(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("channel not found: %s", value)
+	}
+	for _, channel := range channels {
+		if strings.EqualFold(channel.Name, value) {
+			return &channel, nil
+		}
+	}
+	return &channels[0], nil
+}
+
+func truncateChoiceName(name string) string {
+	return truncateName(name, maxChoiceNameLen)
+}
+
+// truncateName shortens a name to at most maxLen bytes, ending it with "...".
+func truncateName(name string, maxLen int) string {
+	if len(name) <= maxLen {
+		return name
+	}
+	runes := []rune(name)
+	for len(string(runes)) > maxLen-3 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const defaultAutoStopGrace = 2 * time.Minute
+
+// What the autopilot plays when the first viewer joins
+const (
+	AutoStartOff     = "off"
+	AutoStartLast    = "last"
+	AutoStartDefault = "default"
+	AutoStartRandom  = "random"
+)
+
+// Autopilot turns the TV on when the first viewer joins the TV voice channel
+// and off once everyone left it for Grace.
+type Autopilot struct {
+	// One of the AutoStart modes, "last" falls back to DefaultChannel and then
+	// to a random channel when nothing was ever played
+	Start          string
+	DefaultChannel string
+	Grace          time.Duration
+
+	presence  *Presence
+	mu        sync.Mutex
+	stopTimer *time.Timer
+}
+
+// NewAutopilot creates an Autopilot driven by the presence tracker, configured
+// from the environment: AUTO_START (off, last, default or random),
+// AUTO_START_CHANNEL (channel ID) and AUTO_STOP_GRACE (Go duration).
+func NewAutopilot(presence *Presence) (*Autopilot, error) {
+	a := &Autopilot{
+		Start:          AutoStartLast,
+		Grace:          defaultAutoStopGrace,
+		DefaultChannel: os.Getenv("AUTO_START_CHANNEL"),
+		presence:       presence,
+	}
+
+	if v, ok := os.LookupEnv("AUTO_START"); ok && v != "" {
+		switch v {
+		case AutoStartOff, AutoStartLast, AutoStartRandom:
+		case AutoStartDefault:
+			if a.DefaultChannel == "" {
+				return nil, fmt.Errorf("AUTO_START=default needs AUTO_START_CHANNEL")
+			}
+		default:
+			return nil, fmt.Errorf("invalid AUTO_START: %q", v)
+		}
+		a.Start = v
+	}
+	if a.DefaultChannel != "" {
+		if _, err := strconv.ParseInt(a.DefaultChannel, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid AUTO_START_CHANNEL: %q", a.DefaultChannel)
+		}
+	}
+	if v, ok := os.LookupEnv("AUTO_STOP_GRACE"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTO_STOP_GRACE: %w", err)
+		}
+		a.Grace = parsed
+	}
+
+	presence.OnChange(a.presenceChange)
+	return a, nil
+}
+
+// presenceChange starts the TV for the first viewer and schedules the stop
+// when the last one leaves, or when nobody is watching as the bot connects.
+func (a *Autopilot) presenceChange(change PresenceChange) {
+	if change.Count > 0 {
+		a.cancelStop()
+		// Only the first viewer, the others join whatever is on or off
+		if change.Joined && change.Count == 1 {
+			a.start(change.Viewer)
+		}
+		return
+	}
+	a.scheduleStop()
+}
+
+func (a *Autopilot) start(viewer Viewer) {
+	if a.Start == AutoStartOff {
+		return
+	}
+
+	ctx := context.Background()
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v\n", err)
+		return
+	}
+	r.Prefix = "channel"
+
+	state, err := r.GetPlayback(ctx)
+	if err != nil {
+		log.Printf("Error getting playback state: %v\n", err)
+		return
+	}
+	if state.Playing {
+		return
+	}
+
+	ctx = models.WithRequester(ctx, models.Requester{UserID: viewer.UserID, UserName: viewer.UserName, GuildID: viewer.GuildID})
+
+	channel, err := a.startChannel(ctx, r)
+	if err != nil {
+		log.Printf("Error auto-starting the TV: %v\n", err)
+		return
+	}
+	log.Printf("%s joined, auto-starting %s", viewer.UserName, channel.Name)
+	if err := r.PublishNotice(ctx, fmt.Sprintf("%s joined, turning the TV on: %s", viewer.UserName, channel.Name)); err != nil {
+		log.Printf("Error publishing notice: %v\n", err)
+	}
+}
+
+// startChannel plays the channel picked by the start mode and returns it.
+func (a *Autopilot) startChannel(ctx context.Context, r *models.RedisStore) (*models.TvChannel, error) {
+	id := ""
+	switch a.Start {
+	case AutoStartLast:
+		current, err := r.GetCurrentChannelID(ctx)
+		if err != nil {
+			log.Printf("Error getting current channel: %v\n", err)
+		}
+		id = current
+		if id == "" {
+			id = a.DefaultChannel
+		}
+	case AutoStartDefault:
+		id = a.DefaultChannel
+	}
+	if id == "" {
+		return r.RandomChannel(ctx)
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel id %q: %w", id, err)
+	}
+	channel, err := r.GetChannelByID(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return channel, r.Play(ctx, n)
+}
+
+// scheduleStop stops the TV after the grace period unless a viewer comes
+// back first.
+func (a *Autopilot) scheduleStop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopTimer != nil {
+		return
+	}
+
+	a.stopTimer = time.AfterFunc(a.Grace, func() {
+		a.mu.Lock()
+		a.stopTimer = nil
+		a.mu.Unlock()
+
+		if a.presence.ViewerCount() > 0 {
+			return
+		}
+
+		ctx := context.Background()
+		r, err := models.NewAuthenticatedRedisClient(ctx)
+		if err != nil {
+			log.Printf("Error creating redis client: %v\n", err)
+			return
+		}
+		r.Prefix = "channel"
+
+		state, err := r.GetPlayback(ctx)
+		if err != nil {
+			log.Printf("Error getting playback state: %v\n", err)
+			return
+		}
+		if !state.Playing {
+			return
+		}
+		log.Println("No one is watching, stopping the TV.")
+		if err := r.Stop(ctx); err != nil {
+			log.Printf("Error stopping the TV: %v\n", err)
+		}
+	})
+}
+
+func (a *Autopilot) cancelStop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopTimer != nil {
+		a.stopTimer.Stop()
+		a.stopTimer = nil
+	}
+}
@@ -2,10 +2,10 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,10 +14,25 @@ import (
 	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
 )
 
+// Number of programmes listed by /guide
+const guideLength = 6
+
+const (
+	// How long commands wait for the streamer to start a stream
+	commandTimeout = 30 * time.Second
+	// How long /restart waits for the streamer to come back
+	restartTimeout = 2 * time.Minute
+)
+
 type Bot struct {
 	DiscordSession *discordgo.Session
+	Autopilot      *Autopilot
 }
 
+// presence tracks the viewers in the TV voice channel, the command handlers
+// query it.
+var presence *Presence
+
 func New() (*Bot, error) {
 	token, ok := os.LookupEnv("DISCORD_BOT_TOKEN")
 	if !ok {
@@ -35,16 +50,38 @@ func New() (*Bot, error) {
 		discordgo.IntentGuildVoiceStates |
 		discordgo.IntentMessageContent
 
+	permissions, err = LoadPermissions()
+	if err != nil {
+		return nil, err
+	}
+	voteConfig, err = LoadVoteConfig()
+	if err != nil {
+		return nil, err
+	}
+	presence, err = NewPresence()
+	if err != nil {
+		return nil, err
+	}
+	autopilot, err := NewAutopilot(presence)
+	if err != nil {
+		return nil, err
+	}
+
 	s.AddHandler(tvHandler)
+	s.AddHandler(presence.voiceStateUpdate)
+	s.AddHandler(presence.guildCreate)
 
 	return &Bot{
 		DiscordSession: s,
+		Autopilot:      autopilot,
 	}, nil
 }
 
 func tvHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	ctx := context.Background()
-	if i.Type != discordgo.InteractionApplicationCommand {
+	if i.Type != discordgo.InteractionApplicationCommand &&
+		i.Type != discordgo.InteractionApplicationCommandAutocomplete &&
+		i.Type != discordgo.InteractionMessageComponent {
 		return
 	}
 
@@ -55,147 +92,146 @@ func tvHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 	r.Prefix = "channel"
 
+	if user := interactionUser(i); user != nil {
+		ctx = models.WithRequester(ctx, models.Requester{
+			UserID:   user.ID,
+			UserName: user.Username,
+			GuildID:  i.GuildID,
+		})
+	}
+
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		autocompleteHandler(ctx, s, i, r)
+		return
+	}
+	action := interactionAction(i)
+	if !authorize(ctx, s, i, r, action) {
+		return
+	}
+	if callVote(ctx, s, i, r, action) {
+		return
+	}
+	generation := djLockGeneration(ctx, r, i, action)
+	defer claimDJLock(ctx, r, i, action, generation)
+	if i.Type == discordgo.InteractionMessageComponent {
+		componentHandler(ctx, s, i, r)
+		return
+	}
+
 	switch i.ApplicationCommandData().Name {
 	case "tv":
-		channelId := i.ApplicationCommandData().Options[0].IntValue()
-		log.Printf("TV command received from user: %s - channelId: %d", i.Member.User.Username, channelId)
+		channelValue := i.ApplicationCommandData().Options[0].StringValue()
+		log.Printf("TV command received from user: %s - channel: %s", i.Member.User.Username, channelValue)
 
-		channelName, err := r.GetChannelByID(ctx, channelId)
+		channelName, err := resolveChannel(ctx, r, channelValue)
 		if err != nil {
-			log.Printf("Error getting channel by ID: %v\n", err)
+			log.Printf("Error resolving channel: %v\n", err)
+			// IDs are not contiguous, retired channels leave gaps
+			err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: fmt.Sprintf("Channel %s not found", channelValue),
+				},
+			})
+			if err != nil {
+				log.Printf("Error responding to command: %v\n", err)
+			}
 			return
 		}
 
-		err = r.Play(ctx, channelId)
-		if err != nil {
-			log.Printf("Error sending command to redis: %v\n", err)
-		}
-
-		err = r.RegisterCurrentChannel(ctx, channelName)
-		if err != nil {
-			log.Printf("Error registering current channel: %v\n", err)
-		}
-
-		// Respond to the interaction
+		// Acknowledge now, the streamer takes a while to report the outcome
 		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("TV channel set to %d - %s", channelId, channelName.Name),
-			},
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		})
-
 		if err != nil {
-			log.Printf("Error responding to command: %v\n", err)
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
 		}
+		sendFollowup(s, i, playChannel(ctx, r, channelName))
 	case "yt":
 		log.Printf("YT command received from user: %s", i.Member.User.Username)
 		url := i.ApplicationCommandData().Options[0].StringValue()
-		tittle, err := r.PlayYoutube(ctx, url)
-		if err != nil {
-			log.Printf("Error sending command to redis: %v\n", err)
-		}
 
-		// Respond to the interaction
-		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("Playing Youtube video: %s", tittle),
-			},
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		})
 		if err != nil {
-			log.Printf("Error responding to command: %v\n", err)
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
 		}
-	case "stop":
-		log.Printf("Stop command received from user: %s", i.Member.User.Username)
 
-		r.Stop(ctx)
-
-		// Respond to the interaction
-		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "TV stopped",
-			},
-		})
+		id := models.NewSessionID()
+		watcher, err := r.WatchEvents(ctx)
 		if err != nil {
-			log.Printf("Error responding to command: %v\n", err)
+			log.Printf("Error watching streamer events: %v\n", err)
+		} else {
+			defer watcher.Close()
 		}
-	case "search":
-		query := i.ApplicationCommandData().Options[0].StringValue()
-		log.Printf("Search command received from user: %s - query: %s", i.Member.User.Username, query)
 
-		channels, err := r.SearchChannelsByName(ctx, query)
+		tittle, err := r.PlayYoutube(models.WithCommandID(ctx, id), url)
 		if err != nil {
-			log.Printf("Error searching for channel: %v\n", err)
+			log.Printf("Error sending command to redis: %v\n", err)
+			sendFollowup(s, i, "Failed to process command")
 			return
 		}
 
-		// Respond to the interaction
-		var content string
-		if len(channels) == 0 {
-			content = "No channels found"
-		} else {
-			content = "Channels found:\n"
-			for _, channel := range channels {
-				content += fmt.Sprintf("%s - %s\n", channel.ID, channel.Name)
+		content := fmt.Sprintf("Playing Youtube video: %s", tittle)
+		if watcher != nil {
+			failed, note := commandOutcome(ctx, watcher, id)
+			if failed {
+				content = fmt.Sprintf("Failed to play Youtube video %s: %s", tittle, note)
+			} else if note != "" {
+				content += fmt.Sprintf(" (%s)", note)
 			}
 		}
-		// Limit content to 1980 characters
-		truncatedMessage := "\n\nSearch truncated, be more specific"
-		maxLen := 2000 - len(truncatedMessage)
-		if len(content) > maxLen {
+		sendFollowup(s, i, content)
+	case "stop":
+		log.Printf("Stop command received from user: %s", i.Member.User.Username)
 
-			content = fmt.Sprintf("%s%s", content[:maxLen], truncatedMessage)
-		}
-		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: content,
-			},
-		})
-		if err != nil {
-			log.Printf("Error responding to command: %v\n", err)
-			return
-		}
+		r.Stop(ctx)
 
-	case "restart":
 		// Respond to the interaction
-		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "Restarting TV",
+				Content: "TV stopped",
 			},
 		})
 		if err != nil {
 			log.Printf("Error responding to command: %v\n", err)
 		}
-
+	case "search":
+		searchCommand(ctx, s, i, r)
+	case "remote":
+		remoteCommand(ctx, s, i, r)
+	case "next":
+		zapCommand(ctx, s, i, r, true)
+	case "prev":
+		zapCommand(ctx, s, i, r, false)
+	case "back":
+		backCommand(ctx, s, i, r)
+	case "history":
+		historyCommand(ctx, s, i, r)
+	case "fav":
+		favCommand(ctx, s, i, r)
+	case "queue":
+		queueCommand(ctx, s, i, r)
+	case "skip":
+		skipCommand(ctx, s, i, r)
+	case "poll":
+		pollCommand(ctx, s, i, r)
+	case "schedule":
+		scheduleCommand(ctx, s, i, r)
+	case "restart":
 		log.Printf("Restart command received from user: %s", i.Member.User.Username)
-		err := r.Stop(ctx)
-		if err != nil {
-			log.Printf("Error sending command to redis: %v\n", err)
-		}
-
-		time.Sleep(1 * time.Second)
-		err = r.Restart(ctx)
-		if err != nil {
-			log.Printf("Error sending command to redis: %v\n", err)
-		}
-		time.Sleep(2 * time.Second)
-		currentChannel, err := r.GetCurrentChannel(ctx)
-		if err != nil {
-			log.Printf("Error getting current channel: %v\n", err)
-		}
-
-		channelID, err := strconv.ParseInt(currentChannel.ID, 10, 64)
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
 		if err != nil {
-			log.Printf("Error parsing channel ID: %v\n", err)
+			log.Printf("Error acknowledging interaction: %v\n", err)
 			return
 		}
-		err = r.Play(ctx, channelID)
-		if err != nil {
-			log.Printf("Error sending command to redis: %v\n", err)
-		}
+		sendFollowup(s, i, restartTV(ctx, r))
 	case "random":
 		log.Printf("Random command received from user: %s", i.Member.User.Username)
 		channel, err := r.RandomChannel(ctx)
@@ -252,11 +288,268 @@ func tvHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		if err != nil {
 			log.Printf("Error responding to command: %v\n", err)
 		}
+	case "guide":
+		channelId := i.ApplicationCommandData().Options[0].IntValue()
+		log.Printf("Guide command received from user: %s - channelId: %d", i.Member.User.Username, channelId)
+
+		var content string
+		channel, err := r.GetChannelByID(ctx, channelId)
+		if err != nil {
+			log.Printf("Error getting channel by ID: %v\n", err)
+			content = fmt.Sprintf("Channel %d not found", channelId)
+		} else {
+			programmes, err := r.GetProgrammes(ctx, channel.ID, time.Now(), guideLength)
+			if err != nil {
+				log.Printf("Error getting programmes: %v\n", err)
+			}
+			if len(programmes) == 0 {
+				content = fmt.Sprintf("No guide available for %s - %s", channel.ID, channel.Name)
+			} else {
+				content = fmt.Sprintf("Guide for %s - %s:\n", channel.ID, channel.Name)
+				for _, p := range programmes {
+					content += formatProgramme(&p) + "\n"
+				}
+			}
+		}
+
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: truncateContent(content),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	case "whatson":
+		query := i.ApplicationCommandData().Options[0].StringValue()
+		log.Printf("Whatson command received from user: %s - query: %s", i.Member.User.Username, query)
+
+		var lines []string
+		seen := make(map[string]bool)
+
+		// Programmes with a matching title
+		programmes, err := r.SearchProgrammesNow(ctx, query)
+		if err != nil {
+			log.Printf("Error searching programmes: %v\n", err)
+		}
+		for _, cp := range programmes {
+			channel, err := r.GetChannelByID(ctx, mustParseID(cp.ChannelID))
+			if err != nil {
+				continue
+			}
+			seen[channel.ID] = true
+			lines = append(lines, fmt.Sprintf("%s - %s: %s", channel.ID, channel.Name, formatProgramme(&cp.Programme)))
+		}
+
+		// Channels with a matching name
+		channels, err := r.SearchChannelsByName(ctx, query)
+		if err != nil {
+			log.Printf("Error searching for channel: %v\n", err)
+		}
+		for _, channel := range channels {
+			if seen[channel.ID] {
+				continue
+			}
+			current, _, err := r.GetNowNext(ctx, channel.ID)
+			if err != nil || current == nil {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s - %s: %s", channel.ID, channel.Name, formatProgramme(current)))
+		}
+
+		content := "Nothing found on the guide"
+		if len(lines) > 0 {
+			content = "On now:\n" + strings.Join(lines, "\n")
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: truncateContent(content),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
 	default:
 		log.Printf("Unknown command: %s\n", i.ApplicationCommandData().Name)
 	}
 }
 
+// componentHandler routes button and select menu interactions by the first
+// part of their custom ID, "<feature>:<action>[:<args>]".
+func componentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	if len(parts) < 2 {
+		log.Printf("Unknown component: %s\n", i.MessageComponentData().CustomID)
+		return
+	}
+	args := ""
+	if len(parts) == 3 {
+		args = parts[2]
+	}
+
+	switch parts[0] {
+	case "search":
+		searchComponentHandler(ctx, s, i, r, parts[1], args)
+	case "remote":
+		remoteComponentHandler(ctx, s, i, r, parts[1])
+	case "history":
+		historyComponentHandler(ctx, s, i, r, parts[1], args)
+	case "fav":
+		favComponentHandler(ctx, s, i, r, parts[1])
+	case "vote":
+		voteComponentHandler(ctx, s, i, r, parts[1], args)
+	case "poll":
+		pollComponentHandler(ctx, s, i, r, parts[1], args)
+	default:
+		log.Printf("Unknown component: %s\n", i.MessageComponentData().CustomID)
+	}
+}
+
+// playChannel switches the TV to the channel and returns the message
+// announcing it, with the programme airing now when the guide knows it. It
+// waits for the streamer to report the outcome, callers must have deferred
+// their interaction response.
+func playChannel(ctx context.Context, r *models.RedisStore, channel *models.TvChannel) string {
+	id := models.NewSessionID()
+	watcher, err := r.WatchEvents(ctx)
+	if err != nil {
+		log.Printf("Error watching streamer events: %v\n", err)
+	} else {
+		defer watcher.Close()
+	}
+
+	err = r.Play(models.WithCommandID(ctx, id), mustParseID(channel.ID))
+	if err != nil {
+		log.Printf("Error sending command to redis: %v\n", err)
+		return fmt.Sprintf("Failed to switch to %s - %s", channel.ID, channel.Name)
+	}
+
+	content := fmt.Sprintf("TV channel set to %s - %s", channel.ID, channel.Name)
+	if watcher != nil {
+		failed, note := commandOutcome(ctx, watcher, id)
+		if failed {
+			return fmt.Sprintf("Failed to play %s - %s: %s", channel.ID, channel.Name, note)
+		}
+		if note != "" {
+			content += fmt.Sprintf(" (%s)", note)
+		}
+	}
+	if current, _, err := r.GetNowNext(ctx, channel.ID); err != nil {
+		log.Printf("Error getting programme: %v\n", err)
+	} else if current != nil {
+		content += fmt.Sprintf("\nNow: %s", formatProgramme(current))
+	}
+	return content
+}
+
+// commandOutcome waits for the streamer to report what happened to the
+// command with the given correlation ID. It returns whether the command
+// failed and a note for the user, empty when the stream started.
+func commandOutcome(ctx context.Context, watcher *models.EventWatcher, id string) (bool, string) {
+	event, acked, err := watcher.WaitOutcome(ctx, id, commandTimeout)
+	switch {
+	case errors.Is(err, models.ErrStreamerTimeout) && acked:
+		return false, "the streamer is still starting it"
+	case err != nil:
+		log.Printf("Error waiting for the streamer: %v\n", err)
+		return true, "the streamer did not answer, it may be down"
+	case event.Event == models.EventError:
+		return true, event.Error
+	case event.Event == models.EventEnded:
+		return false, "it ended right away"
+	}
+	return false, ""
+}
+
+// restartTV restarts the streamer, which plays the desired channel again once
+// it is back. It returns the message for the user.
+func restartTV(ctx context.Context, r *models.RedisStore) string {
+	watcher, err := r.WatchEvents(ctx)
+	if err != nil {
+		log.Printf("Error watching streamer events: %v\n", err)
+		return "Failed to process command"
+	}
+	defer watcher.Close()
+
+	err = r.Restart(ctx)
+	if err != nil {
+		log.Printf("Error sending command to redis: %v\n", err)
+		return "Failed to process command"
+	}
+
+	// The streamer exits and reports back with a boot heartbeat
+	waitCtx, cancel := context.WithTimeout(ctx, restartTimeout)
+	defer cancel()
+	_, err = watcher.WaitFor(waitCtx, func(e *models.StreamerEvent) bool {
+		return e.Event == models.EventHeartbeat && e.Boot
+	})
+	if err != nil {
+		log.Printf("Error waiting for the streamer: %v\n", err)
+		return "The streamer did not come back after the restart, it may be down"
+	}
+
+	state, err := r.GetPlayback(ctx)
+	if err != nil || !state.Playing {
+		return "TV restarted"
+	}
+
+	waitCtx, cancel = context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	event, err := watcher.WaitFor(waitCtx, func(e *models.StreamerEvent) bool {
+		return e.Command == "play" && (e.Event == models.EventStarted || e.Event == models.EventError)
+	})
+	switch {
+	case err != nil:
+		return fmt.Sprintf("TV restarted, the streamer is still starting %s", state.Title)
+	case event.Event == models.EventError:
+		return fmt.Sprintf("TV restarted but %s failed: %s", state.Title, event.Error)
+	}
+	return fmt.Sprintf("TV restarted, back on %s", state.Title)
+}
+
+// interactionUser returns who triggered the interaction, in guilds and DMs.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to interaction: %v\n", err)
+	}
+}
+
+// formatProgramme formats a programme as "21:00-22:30 Title" in local time.
+func formatProgramme(p *models.Programme) string {
+	return fmt.Sprintf("%s-%s %s", p.Start.Local().Format("15:04"), p.Stop.Local().Format("15:04"), p.Title)
+}
+
+// truncateContent keeps a message under the Discord limit of 2000 characters.
+func truncateContent(content string) string {
+	truncatedMessage := "\n\nResults truncated, be more specific"
+	maxLen := 2000 - len(truncatedMessage)
+	if len(content) > maxLen {
+		return fmt.Sprintf("%s%s", content[:maxLen], truncatedMessage)
+	}
+	return content
+}
+
+func mustParseID(id string) int64 {
+	parsed, _ := strconv.ParseInt(id, 10, 64)
+	return parsed
+}
+
 func sendFollowup(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
 	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 		Content: content,
@@ -276,24 +569,22 @@ func AddCommands(s *discordgo.Session) {
 
 	// Define and create the TV command
 	r.Prefix = "channel"
-	channelsLen, err := r.GetChannelCounter(ctx)
+	minID, maxID, err := r.GetChannelIDRange(ctx)
 	if err != nil {
-		log.Printf("Error getting channel count: %v\n", err)
+		log.Printf("Error getting channel ID range: %v\n", err)
 		return
 	}
-	channelsLen-- // The counter starts at 0
 
 	tvCommand := &discordgo.ApplicationCommand{
 		Name:        "tv",
 		Description: "Set the TV channel",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
-				Type:        discordgo.ApplicationCommandOptionInteger,
-				Name:        "channel",
-				Description: fmt.Sprintf("Channel ID (0-%d)", channelsLen),
-				Required:    true,
-				MinValue:    &[]float64{0}[0],
-				MaxValue:    float64(channelsLen),
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "channel",
+				Description:  fmt.Sprintf("Channel name or ID (%d-%d)", minID, maxID),
+				Required:     true,
+				Autocomplete: true,
 			},
 		},
 	}
@@ -344,10 +635,11 @@ func AddCommands(s *discordgo.Session) {
 		Description: "Search for a TV channel",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "query",
-				Description: "Search for a channel, you can use multiple words",
-				Required:    true,
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "query",
+				Description:  "Search for a channel, you can use multiple words",
+				Required:     true,
+				Autocomplete: true,
 			},
 		},
 	}
@@ -395,63 +687,296 @@ func AddCommands(s *discordgo.Session) {
 		return
 	}
 	log.Printf("catalog command added: %v\n", c.Name)
-}
 
-func DeleteCommands(s *discordgo.Session) {
-	commands, err := s.ApplicationCommands(s.State.User.ID, "")
+	guideCommand := &discordgo.ApplicationCommand{
+		Name:        "guide",
+		Description: "Show the programme guide of a TV channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "channel",
+				Description: fmt.Sprintf("Channel ID (%d-%d)", minID, maxID),
+				Required:    true,
+				MinValue:    &[]float64{float64(minID)}[0],
+				MaxValue:    float64(maxID),
+			},
+		},
+	}
+
+	c, err = s.ApplicationCommandCreate(s.State.User.ID, "", guideCommand)
 	if err != nil {
-		log.Printf("Error getting slash commands: %v\n", err)
+		log.Printf("Error creating slash command: %v\n", err)
+		return
+	}
+	log.Printf("guide command added: %v\n", c.Name)
+
+	whatsonCommand := &discordgo.ApplicationCommand{
+		Name:        "whatson",
+		Description: "Find what is on TV right now",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "query",
+				Description: "A programme title or channel name",
+				Required:    true,
+			},
+		},
+	}
+
+	c, err = s.ApplicationCommandCreate(s.State.User.ID, "", whatsonCommand)
+	if err != nil {
+		log.Printf("Error creating slash command: %v\n", err)
 		return
 	}
+	log.Printf("whatson command added: %v\n", c.Name)
+
+	remoteCommand := &discordgo.ApplicationCommand{
+		Name:        "remote",
+		Description: "Post a remote control for the TV in this channel",
+	}
+
+	c, err = s.ApplicationCommandCreate(s.State.User.ID, "", remoteCommand)
+	if err != nil {
+		log.Printf("Error creating slash command: %v\n", err)
+		return
+	}
+	log.Printf("remote command added: %v\n", c.Name)
+
+	sameGroupOption := []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "same_group",
+			Description: "Stay within the group of the current channel",
+		},
+	}
+	scopeOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "scope",
+		Description: "Your favorites or the ones shared by the server",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "me", Value: "me"},
+			{Name: "server", Value: "server"},
+		},
+	}
+	favoriteOption := func(description string, required bool) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "channel",
+			Description:  description,
+			Required:     required,
+			Autocomplete: true,
+		}
+	}
+	favoritesCommand := &discordgo.ApplicationCommand{
+		Name:        "fav",
+		Description: "Manage favorite TV channels",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a channel to the favorites",
+				Options:     []*discordgo.ApplicationCommandOption{favoriteOption("Channel name or ID, the current channel if empty", false), scopeOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a channel from the favorites",
+				Options:     []*discordgo.ApplicationCommandOption{favoriteOption("A favorite channel", true), scopeOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the favorite channels",
+				Options:     []*discordgo.ApplicationCommandOption{scopeOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "play",
+				Description: "Play a favorite channel",
+				Options:     []*discordgo.ApplicationCommandOption{favoriteOption("A favorite channel", true), scopeOption},
+			},
+		},
+	}
+
+	schedulingCommand := &discordgo.ApplicationCommand{
+		Name:        "schedule",
+		Description: "Turn the TV to a channel, or off, at a given time",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Schedule a channel, or turning the TV off",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "channel",
+						Description:  "Channel name or ID",
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "at",
+						Description: "21:45, 2026-10-20 21:45 or a cron expression like 45 21 * * 1-5",
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "programme",
+						Description:  "A programme from the guide, instead of a time",
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "repeat",
+						Description: "Repeat at the same time, once by default",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "once", Value: "once"},
+							{Name: "daily", Value: "daily"},
+							{Name: "weekdays", Value: "weekdays"},
+							{Name: "weekends", Value: "weekends"},
+							{Name: "weekly", Value: "weekly"},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "action",
+						Description: "Play the channel, the default, or turn the TV off (when the programme ends)",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "play", Value: models.ScheduleActionPlay},
+							{Name: "stop", Value: models.ScheduleActionStop},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "timezone",
+						Description: "Time zone like America/Sao_Paulo, the one of the bot by default",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List what is scheduled",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "cancel",
+				Description: "Cancel something scheduled",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "job",
+						Description:  "What to cancel",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
+	}
 
+	commands := []*discordgo.ApplicationCommand{
+		{
+			Name:        "next",
+			Description: "Switch to the next TV channel",
+			Options:     sameGroupOption,
+		},
+		{
+			Name:        "prev",
+			Description: "Switch to the previous TV channel",
+			Options:     sameGroupOption,
+		},
+		{
+			Name:        "back",
+			Description: "Go back to the last channel watched",
+		},
+		{
+			Name:        "history",
+			Description: "Show what was played on the TV",
+		},
+		favoritesCommand,
+		{
+			Name:        "queue",
+			Description: "Manage the play queue of Youtube videos and media files",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Add a Youtube video or media URL to the queue",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "url",
+							Description: "A Youtube video or media file URL",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List the queue",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Remove an item from the queue",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "position",
+							Description: "Position in /queue list",
+							Required:    true,
+							MinValue:    &[]float64{1}[0],
+							MaxValue:    models.MaxQueueLength,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear",
+					Description: "Remove every item from the queue",
+				},
+			},
+		},
+		{
+			Name:        "skip",
+			Description: "Play the next item of the queue",
+		},
+		{
+			Name:        "poll",
+			Description: "Let everyone pick the next channel from up to 5 candidates",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "channels",
+					Description: "A search query or channels separated by commas, favorites and random picks if empty",
+				},
+			},
+		},
+		schedulingCommand,
+	}
 	for _, command := range commands {
-		err = s.ApplicationCommandDelete(s.State.User.ID, "", command.ID)
+		c, err = s.ApplicationCommandCreate(s.State.User.ID, "", command)
 		if err != nil {
-			log.Printf("Error deleting slash command: %v\n", err)
+			log.Printf("Error creating slash command: %v\n", err)
+			return
 		}
-		log.Printf("Command deleted: %s\n", command.Name)
+		log.Printf("%s command added: %v\n", command.Name, c.Name)
 	}
 }
 
-func IsAnyoneWatching(ctx context.Context, s *discordgo.Session) bool {
-	guilds, err := s.UserGuilds(200, "", "", true)
+func DeleteCommands(s *discordgo.Session) {
+	commands, err := s.ApplicationCommands(s.State.User.ID, "")
 	if err != nil {
-		return true
+		log.Printf("Error getting slash commands: %v\n", err)
+		return
 	}
-	for _, guild := range guilds {
-		// Register oncall users
-		guildID := guild.ID
-		members, err := s.GuildMembers(guildID, "", 1000)
-		if err != nil {
-			log.Printf("error fetching members for guild %s: %v", guildID, err)
-			continue
-		}
-		oncallUsersCount := 0
-		for _, member := range members {
-			if member.User.Bot {
-				continue
-			}
-			vs, _ := s.State.VoiceState(guildID, member.User.ID) // it errors out if the user is not in a voice channel, ignore it
-			if vs != nil && vs.ChannelID != "" {
-				// Check if user is on an ignored channel
-				currentVoiceChannel, err := s.Channel(vs.ChannelID)
-				if err != nil {
-					log.Printf("error fetching channel for user %s: %v", member.User.ID, err)
-					continue
-				}
-				ignoredChannels := strings.Split(os.Getenv("DISCORD_IGNORED_CHANNELS"), ",")
-				if slices.Contains(ignoredChannels, currentVoiceChannel.Name) {
-					log.Printf("Ignoring user %s in ignored channel %s", member.User.ID, currentVoiceChannel.Name)
-					continue
-				}
 
-				oncallUsersCount++
-			}
-		}
-		// If anyone other than the bot is watching, return true
-		if oncallUsersCount > 1 {
-			return true
+	for _, command := range commands {
+		err = s.ApplicationCommandDelete(s.State.User.ID, "", command.ID)
+		if err != nil {
+			log.Printf("Error deleting slash command: %v\n", err)
 		}
+		log.Printf("Command deleted: %s\n", command.Name)
 	}
-	return false
 }
@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/search"
+)
+
+// favCommand answers the /fav add|remove|list|play subcommands. The scope
+// option picks the favorites of the user ("me", the default) or the shared
+// favorites of the server ("server").
+func favCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	sub := i.ApplicationCommandData().Options[0]
+	options := make(map[string]string)
+	for _, option := range sub.Options {
+		options[option.Name] = option.StringValue()
+	}
+	log.Printf("Fav %s command received from user: %s - %v", sub.Name, interactionUser(i).Username, options)
+
+	scope, ownerID, label := favoritesOwner(i, options["scope"])
+	if ownerID == "" {
+		respondEphemeral(s, i, "Server favorites are only available in a server")
+		return
+	}
+
+	switch sub.Name {
+	case "add":
+		var channel *models.TvChannel
+		var err error
+		if value := options["channel"]; value != "" {
+			channel, err = resolveChannel(ctx, r, value)
+		} else {
+			channel, err = r.GetCurrentChannel(ctx)
+		}
+		if err != nil {
+			log.Printf("Error resolving channel: %v\n", err)
+			respondEphemeral(s, i, fmt.Sprintf("Channel %s not found", options["channel"]))
+			return
+		}
+
+		added, err := r.AddFavorite(ctx, scope, ownerID, channel)
+		if err != nil {
+			log.Printf("Error adding favorite: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		if !added {
+			respondEphemeral(s, i, fmt.Sprintf("%s - %s already is in %s", channel.ID, channel.Name, label))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("Added %s - %s to %s", channel.ID, channel.Name, label))
+	case "remove":
+		value := options["channel"]
+		removed, err := r.RemoveFavorite(ctx, scope, ownerID, value)
+		if err == nil && removed == nil {
+			// Typed instead of picked from the suggestions
+			if channel, resolveErr := resolveChannel(ctx, r, value); resolveErr == nil {
+				removed, err = r.RemoveFavorite(ctx, scope, ownerID, channel.ID)
+			}
+		}
+		if err != nil {
+			log.Printf("Error removing favorite: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		if removed == nil {
+			respondEphemeral(s, i, fmt.Sprintf("%s is not in %s", value, label))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("Removed %s from %s", removed.Name, label))
+	case "list":
+		favorites, err := r.GetFavorites(ctx, scope, ownerID)
+		if err != nil {
+			log.Printf("Error getting favorites: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		data := renderFavorites(favorites, strings.ToUpper(label[:1])+label[1:])
+		if scope == models.FavoritesUser {
+			data.Flags = discordgo.MessageFlagsEphemeral
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: data,
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	case "play":
+		favorites, err := r.GetFavorites(ctx, scope, ownerID)
+		if err != nil {
+			log.Printf("Error getting favorites: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		channel := findFavorite(favorites, options["channel"])
+		if channel == nil {
+			respondEphemeral(s, i, fmt.Sprintf("%s is not in %s", options["channel"], label))
+			return
+		}
+
+		// Switching channels takes longer than Discord waits for an answer
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
+		}
+		sendFollowup(s, i, playChannel(ctx, r, channel))
+	}
+}
+
+// favComponentHandler handles the select menu of a favorites list, its custom
+// ID is "fav:play".
+func favComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action string) {
+	values := i.MessageComponentData().Values
+	if action != "play" || len(values) == 0 {
+		log.Printf("Unknown fav action: %s\n", action)
+		return
+	}
+	log.Printf("Fav play received from user: %s - channel: %s", interactionUser(i).Username, values[0])
+
+	channel, err := r.GetChannelByID(ctx, mustParseID(values[0]))
+	if err != nil {
+		log.Printf("Error getting channel by ID: %v\n", err)
+		respondEphemeral(s, i, fmt.Sprintf("Channel %s not found", values[0]))
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error acknowledging interaction: %v\n", err)
+		return
+	}
+	sendFollowup(s, i, playChannel(ctx, r, channel))
+}
+
+// favoritesOwner maps the scope option to the favorites scope, owner ID and a
+// label for messages. The owner is empty for server favorites outside guilds.
+func favoritesOwner(i *discordgo.InteractionCreate, scope string) (string, string, string) {
+	if scope == "server" {
+		return models.FavoritesGuild, i.GuildID, "the server favorites"
+	}
+	return models.FavoritesUser, interactionUser(i).ID, "your favorites"
+}
+
+// findFavorite returns the channel of the favorite matching value, a favorite
+// key, a channel ID or a name.
+func findFavorite(favorites []models.Favorite, value string) *models.TvChannel {
+	value = strings.TrimSpace(value)
+	for _, f := range favorites {
+		if f.Channel == nil {
+			continue
+		}
+		if f.Key == value || f.Channel.ID == value || strings.EqualFold(f.Channel.Name, value) {
+			return f.Channel
+		}
+	}
+	return nil
+}
+
+// renderFavorites lists favorites in an embed with a select menu to play them.
+// Favorites missing from the catalog are listed but cannot be played.
+func renderFavorites(favorites []models.Favorite, title string) *discordgo.InteractionResponseData {
+	if len(favorites) == 0 {
+		return &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("%s: none yet, add some with /fav add", title),
+		}
+	}
+
+	var lines []string
+	var options []discordgo.SelectMenuOption
+	for _, f := range favorites {
+		if f.Channel == nil {
+			lines = append(lines, fmt.Sprintf("~~%s~~ (not in the catalog)", f.Name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("`%s` %s", f.Channel.ID, f.Channel.Name))
+		// Discord rejects a menu with the same value twice, two favorites can
+		// point to the same channel
+		if len(options) < maxChoices && !slices.ContainsFunc(options, func(o discordgo.SelectMenuOption) bool { return o.Value == f.Channel.ID }) {
+			options = append(options, discordgo.SelectMenuOption{
+				Label: truncateChoiceName(fmt.Sprintf("%s - %s", f.Channel.ID, f.Channel.Name)),
+				Value: f.Channel.ID,
+			})
+		}
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       title,
+				Description: truncateContent(strings.Join(lines, "\n")),
+			},
+		},
+	}
+	if len(options) > 0 {
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						CustomID:    "fav:play",
+						Placeholder: "Pick a favorite to watch",
+						Options:     options,
+					},
+				},
+			},
+		}
+	}
+	return data
+}
+
+// favoritesChoices suggests favorites whose name matches the query.
+func favoritesChoices(favorites []models.Favorite, query string) []*discordgo.ApplicationCommandOptionChoice {
+	folded := search.Fold(query)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, f := range favorites {
+		if len(choices) == maxChoices {
+			break
+		}
+		if !strings.Contains(search.Fold(f.Name), folded) {
+			continue
+		}
+		name := f.Name
+		if f.Channel != nil {
+			name = fmt.Sprintf("%s - %s", f.Channel.ID, f.Channel.Name)
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateChoiceName(name),
+			Value: f.Key,
+		})
+	}
+	return choices
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// One replay button per entry, a row holds at most 5 buttons
+const historyPageSize = 5
+
+// historyCommand answers /history with the most recent plays.
+func historyCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	log.Printf("History command received from user: %s", interactionUser(i).Username)
+
+	data, err := renderHistoryPage(ctx, r, 0)
+	if err != nil {
+		log.Printf("Error getting history: %v\n", err)
+		respondEphemeral(s, i, "Failed to process command")
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error responding to command: %v\n", err)
+	}
+}
+
+// historyComponentHandler handles the buttons of a history message. Custom IDs
+// are "history:page:<page>" and "history:replay:<entry id>".
+func historyComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action, args string) {
+	switch action {
+	case "page":
+		page, _ := strconv.Atoi(args)
+		data, err := renderHistoryPage(ctx, r, max(page, 0))
+		if err != nil {
+			log.Printf("Error getting history: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: data,
+		})
+		if err != nil {
+			log.Printf("Error responding to component: %v\n", err)
+		}
+	case "replay":
+		log.Printf("History replay received from user: %s - entry: %s", interactionUser(i).Username, args)
+		entry, err := r.GetHistoryEntry(ctx, args)
+		if err != nil {
+			log.Printf("Error getting history entry: %v\n", err)
+			respondEphemeral(s, i, "This entry is not in the history anymore")
+			return
+		}
+
+		// Switching channels takes longer than Discord waits for an answer
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
+		}
+
+		if entry.ChannelID == "" {
+			title, err := r.PlayYoutube(ctx, entry.URL)
+			if err != nil {
+				log.Printf("Error sending command to redis: %v\n", err)
+				sendFollowup(s, i, "Failed to process command")
+				return
+			}
+			sendFollowup(s, i, fmt.Sprintf("Playing Youtube video: %s", title))
+			return
+		}
+
+		channel, err := r.GetChannelByID(ctx, mustParseID(entry.ChannelID))
+		if err != nil {
+			log.Printf("Error getting channel by ID: %v\n", err)
+			sendFollowup(s, i, fmt.Sprintf("%s is not in the catalog anymore", entry.Title))
+			return
+		}
+		sendFollowup(s, i, playChannel(ctx, r, channel))
+	default:
+		log.Printf("Unknown history action: %s\n", action)
+	}
+}
+
+// renderHistoryPage builds the embed and buttons of one page of the history.
+func renderHistoryPage(ctx context.Context, r *models.RedisStore, page int) (*discordgo.InteractionResponseData, error) {
+	entries, total, err := r.GetHistory(ctx, page, historyPageSize)
+	if err != nil {
+		return nil, err
+	}
+	pages := max((total+historyPageSize-1)/historyPageSize, 1)
+	if page >= pages {
+		page = pages - 1
+		if entries, total, err = r.GetHistory(ctx, page, historyPageSize); err != nil {
+			return nil, err
+		}
+	}
+	if total == 0 {
+		return &discordgo.InteractionResponseData{
+			Content:    "Nothing was played yet",
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		}, nil
+	}
+
+	var lines []string
+	var replays []discordgo.MessageComponent
+	for n, entry := range entries {
+		number := page*historyPageSize + n + 1
+		lines = append(lines, fmt.Sprintf("`%d.` %s", number, formatHistoryEntry(&entry)))
+		replays = append(replays, discordgo.Button{
+			Label:    fmt.Sprintf("Replay %d", number),
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("history:replay:%s", entry.ID),
+		})
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Playback history",
+				Description: strings.Join(lines, "\n"),
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: fmt.Sprintf("Page %d/%d - %d plays", page+1, pages, total),
+				},
+			},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: replays},
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Newer",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("history:page:%d", page-1),
+						Disabled: page == 0,
+					},
+					discordgo.Button{
+						Label:    "Older",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("history:page:%d", page+1),
+						Disabled: page >= pages-1,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// formatHistoryEntry formats an entry as "<when> TITLE (ID) by USER, NOTE,
+// DURATION".
+func formatHistoryEntry(entry *models.HistoryEntry) string {
+	line := fmt.Sprintf("<t:%d:f> **%s**", entry.StartedAt.Unix(), entry.Title)
+	if entry.ChannelID != "" {
+		line += fmt.Sprintf(" (%s)", entry.ChannelID)
+	} else {
+		line += " (Youtube)"
+	}
+	if entry.UserName != "" {
+		line += fmt.Sprintf(" by %s", entry.UserName)
+	}
+	if entry.Note != "" {
+		line += fmt.Sprintf(", %s", entry.Note)
+	}
+	switch {
+	case entry.Open:
+		line += ", on now"
+	case entry.Duration < time.Minute:
+		line += ", under a minute"
+	default:
+		line += fmt.Sprintf(", %s", strings.TrimSuffix(entry.Duration.Round(time.Minute).String(), "0s"))
+	}
+	return line
+}
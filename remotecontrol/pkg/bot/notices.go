@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// WatchNotices posts the notices published by remotecontrol, such as a
+// failover, until the context is cancelled. They go to the text channel in
+// DISCORD_NOTICES_CHANNEL_ID, or to every channel with a remote panel when it
+// is not set.
+func WatchNotices(ctx context.Context, s *discordgo.Session) {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v\n", err)
+		return
+	}
+	r.Prefix = "channel"
+
+	pubsub := r.SubscribeNotices(ctx)
+	defer pubsub.Close()
+	notices := pubsub.Channel()
+
+	for {
+		select {
+		case msg := <-notices:
+			postNotice(ctx, s, r, msg.Payload)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func postNotice(ctx context.Context, s *discordgo.Session, r *models.RedisStore, text string) {
+	var channelIDs []string
+	if channelID, ok := os.LookupEnv("DISCORD_NOTICES_CHANNEL_ID"); ok && channelID != "" {
+		channelIDs = append(channelIDs, channelID)
+	} else {
+		panels, err := r.GetPanels(ctx)
+		if err != nil {
+			log.Printf("Error getting remote panels: %v\n", err)
+			return
+		}
+		for channelID := range panels {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+
+	for _, channelID := range channelIDs {
+		if _, err := s.ChannelMessageSend(channelID, truncateContent(text)); err != nil {
+			log.Printf("Error posting notice to %s: %v\n", channelID, err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// Allowed lists who may do something, by role or user ID.
+type Allowed struct {
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// GuildPermissions is the permission config of a guild. Commands maps a
+// command, or "command subcommand", to who may run it, commands not listed
+// are open to everyone. Moderators, and members who can manage the server,
+// may run everything and ignore the DJ lock. With DJLockMinutes set whoever
+// changes the channel is the only one in the guild who may change it again for
+// that long, every guild has its own lock.
+type GuildPermissions struct {
+	Moderators    Allowed            `json:"moderators"`
+	Commands      map[string]Allowed `json:"commands,omitempty"`
+	DJLockMinutes int                `json:"dj_lock_minutes,omitempty"`
+}
+
+// Permissions holds the config of every guild, guilds not listed use the
+// "default" entry.
+type Permissions map[string]GuildPermissions
+
+// permissions is loaded once by New, empty when no file is configured.
+var permissions Permissions
+
+// Commands that change what is on the TV, now or later, the DJ lock applies
+// to them
+var channelChanging = []string{"tv", "yt", "random", "next", "prev", "back", "skip", "stop", "fav play", "schedule add"}
+
+// Components that are a shortcut for a command, by "feature:action"
+var componentActions = map[string]string{
+	"remote:up":      "next",
+	"remote:down":    "prev",
+	"remote:random":  "random",
+	"remote:stop":    "stop",
+	"remote:restart": "restart",
+	"search:play":    "tv",
+	"history:replay": "tv",
+	"fav:play":       "fav play",
+}
+
+// LoadPermissions reads the permission config from the JSON file pointed to
+// by PERMISSIONS_FILE. Without it everyone may run every command.
+func LoadPermissions() (Permissions, error) {
+	permissions := Permissions{}
+	path, ok := os.LookupEnv("PERMISSIONS_FILE")
+	if !ok || path == "" {
+		return permissions, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permissions: %w", err)
+	}
+	if err := json.Unmarshal(data, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions: %w", err)
+	}
+	for guildID, guild := range permissions {
+		if guild.DJLockMinutes < 0 {
+			return nil, fmt.Errorf("invalid dj_lock_minutes for guild %s: %d", guildID, guild.DJLockMinutes)
+		}
+	}
+	return permissions, nil
+}
+
+func (p Permissions) guild(guildID string) GuildPermissions {
+	if guild, ok := p[guildID]; ok {
+		return guild
+	}
+	return p["default"]
+}
+
+func (a Allowed) allows(member *discordgo.Member) bool {
+	if member == nil || member.User == nil {
+		return false
+	}
+	if slices.Contains(a.Users, member.User.ID) {
+		return true
+	}
+	for _, role := range member.Roles {
+		if slices.Contains(a.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentions lists who is allowed, mentions in ephemeral messages ping nobody.
+func (a Allowed) mentions() string {
+	var names []string
+	for _, role := range a.Roles {
+		names = append(names, fmt.Sprintf("<@&%s>", role))
+	}
+	for _, user := range a.Users {
+		names = append(names, fmt.Sprintf("<@%s>", user))
+	}
+	return strings.Join(names, ", ")
+}
+
+func isModerator(guild GuildPermissions, member *discordgo.Member) bool {
+	if member != nil && member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+		return true
+	}
+	return guild.Moderators.allows(member)
+}
+
+// interactionAction returns the command an interaction runs, "command
+// subcommand" for commands with subcommands. Components run the command they
+// are a shortcut for, or none.
+func interactionAction(i *discordgo.InteractionCreate) string {
+	if i.Type == discordgo.InteractionMessageComponent {
+		parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+		if len(parts) < 2 {
+			return ""
+		}
+		return componentActions[parts[0]+":"+parts[1]]
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) > 0 && data.Options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		return data.Name + " " + data.Options[0].Name
+	}
+	return data.Name
+}
+
+// authorize reports whether whoever triggered the interaction may run the
+// action, answering with an ephemeral denial when not.
+func authorize(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action string) bool {
+	if action == "" {
+		return true
+	}
+	guild := permissions.guild(i.GuildID)
+	moderator := isModerator(guild, i.Member)
+
+	if !moderator {
+		allowed, ok := guild.Commands[action]
+		if !ok {
+			allowed, ok = guild.Commands[strings.Fields(action)[0]]
+		}
+		if ok && !allowed.allows(i.Member) {
+			who := "moderators"
+			if mentions := allowed.mentions(); mentions != "" {
+				who = mentions + " and moderators"
+			}
+			respondEphemeral(s, i, fmt.Sprintf("Only %s can use /%s", who, action))
+			return false
+		}
+	}
+
+	if !slices.Contains(channelChanging, action) {
+		return true
+	}
+	if lock := djLockHolder(ctx, r, i); lock != nil {
+		respondEphemeral(s, i, fmt.Sprintf("%s is the DJ until <t:%d:t>, only they or a moderator can change the channel before that",
+			lock.UserName, lock.Until.Unix()))
+		return false
+	}
+	return true
+}
+
+// djLockHolder returns the DJ lock when someone else holds it and it applies
+// to whoever triggered the interaction, nil when they may change the channel.
+func djLockHolder(ctx context.Context, r *models.RedisStore, i *discordgo.InteractionCreate) *models.DJLock {
+	guild := permissions.guild(i.GuildID)
+	if guild.DJLockMinutes == 0 || isModerator(guild, i.Member) {
+		return nil
+	}
+	lock, err := r.GetDJLock(ctx, i.GuildID)
+	if err != nil {
+		log.Printf("Error getting dj lock: %v\n", err)
+	}
+	if lock == nil || lock.UserID == interactionUser(i).ID {
+		return nil
+	}
+	return lock
+}
+
+// djLockGeneration returns the desired state generation before a channel
+// changing action runs, claimDJLock compares against it. It is -1 when the
+// action takes no DJ lock.
+func djLockGeneration(ctx context.Context, r *models.RedisStore, i *discordgo.InteractionCreate, action string) int64 {
+	guild := permissions.guild(i.GuildID)
+	if guild.DJLockMinutes == 0 || !slices.Contains(channelChanging, action) {
+		return -1
+	}
+	desired, err := r.GetDesired(ctx)
+	if err != nil {
+		log.Printf("Error getting desired state: %v\n", err)
+		return -1
+	}
+	return desired.Generation
+}
+
+// claimDJLock gives the DJ lock to whoever changed the channel, once the
+// action changed the desired state since the generation returned by
+// djLockGeneration. Commands that failed change nothing and take no lock.
+// Stopping the TV releases it.
+func claimDJLock(ctx context.Context, r *models.RedisStore, i *discordgo.InteractionCreate, action string, generation int64) {
+	if generation < 0 {
+		return
+	}
+	desired, err := r.GetDesired(ctx)
+	if err != nil {
+		log.Printf("Error getting desired state: %v\n", err)
+		return
+	}
+	if desired.Generation <= generation {
+		return
+	}
+
+	guild := permissions.guild(i.GuildID)
+	if action == "stop" {
+		err = r.ClearDJLock(ctx, i.GuildID)
+	} else {
+		user := interactionUser(i)
+		err = r.SetDJLock(ctx, models.DJLock{
+			UserID:   user.ID,
+			UserName: user.Username,
+			GuildID:  i.GuildID,
+			Until:    time.Now().Add(time.Duration(guild.DJLockMinutes) * time.Minute),
+		})
+	}
+	if err != nil {
+		log.Printf("Error updating dj lock: %v\n", err)
+	}
+}
@@ -0,0 +1,313 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const (
+	// Discord fits 5 buttons in a row
+	maxPollCandidates = 5
+	maxButtonLabelLen = 80
+)
+
+type poll struct {
+	id string
+	// The interaction that opened the poll, its response is the poll message
+	interaction *discordgo.InteractionCreate
+	candidates  []models.TvChannel
+	// Discord user ID to the index of the candidate they voted for, one
+	// ballot per user
+	ballots  map[string]int
+	deadline time.Time
+	timer    *time.Timer
+	closed   bool
+}
+
+// The open poll, only one runs at a time since they would fight over the TV.
+// Guarded by votesMu like the votes.
+var activePoll *poll
+
+// pollCommand opens a poll between up to 5 channels. The option is a search
+// query or channels separated by commas, without it the candidates are the
+// favorites of the user and the server topped up with random picks.
+func pollCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	value := ""
+	if options := i.ApplicationCommandData().Options; len(options) > 0 {
+		value = options[0].StringValue()
+	}
+	user := interactionUser(i)
+	log.Printf("Poll command received from user: %s - %s", user.Username, value)
+
+	candidates, err := pollCandidates(ctx, r, i, value)
+	if err != nil {
+		log.Printf("Error getting poll candidates: %v\n", err)
+		respondEphemeral(s, i, "Failed to process command")
+		return
+	}
+	if len(candidates) < 2 {
+		respondEphemeral(s, i, fmt.Sprintf("A poll needs at least 2 channels, %q matched %d", value, len(candidates)))
+		return
+	}
+
+	p := &poll{
+		id:          models.NewSessionID(),
+		interaction: i,
+		candidates:  candidates,
+		ballots:     make(map[string]int),
+		deadline:    time.Now().Add(voteConfig.PollTimeout),
+	}
+
+	votesMu.Lock()
+	if activePoll != nil {
+		deadline := activePoll.deadline
+		votesMu.Unlock()
+		respondEphemeral(s, i, fmt.Sprintf("A poll is already open, it closes <t:%d:R>", deadline.Unix()))
+		return
+	}
+	activePoll = p
+	content, components := p.render()
+	p.timer = time.AfterFunc(voteConfig.PollTimeout, func() { closePoll(s, r, p) })
+	votesMu.Unlock()
+	log.Printf("Poll %s opened by %s with %d channels", p.id, user.Username, len(candidates))
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to command: %v\n", err)
+	}
+}
+
+// pollCandidates returns the channels a poll offers, at most
+// maxPollCandidates and without duplicates.
+func pollCandidates(ctx context.Context, r *models.RedisStore, i *discordgo.InteractionCreate, value string) ([]models.TvChannel, error) {
+	var candidates []models.TvChannel
+	add := func(channel *models.TvChannel) {
+		if len(candidates) < maxPollCandidates &&
+			!slices.ContainsFunc(candidates, func(c models.TvChannel) bool { return c.ID == channel.ID }) {
+			candidates = append(candidates, *channel)
+		}
+	}
+
+	switch {
+	case strings.Contains(value, ","):
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			channel, err := resolveChannel(ctx, r, part)
+			if err != nil {
+				log.Printf("Error resolving channel: %v\n", err)
+				continue
+			}
+			add(channel)
+		}
+	case strings.TrimSpace(value) != "":
+		channels, err := r.SearchChannelsByName(ctx, strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		for n := range channels {
+			add(&channels[n])
+		}
+	default:
+		owners := [][2]string{{models.FavoritesUser, interactionUser(i).ID}, {models.FavoritesGuild, i.GuildID}}
+		for _, owner := range owners {
+			if owner[1] == "" {
+				continue
+			}
+			favorites, err := r.GetFavorites(ctx, owner[0], owner[1])
+			if err != nil {
+				return nil, err
+			}
+			// Not always the first ones by name
+			rand.Shuffle(len(favorites), func(a, b int) { favorites[a], favorites[b] = favorites[b], favorites[a] })
+			for _, favorite := range favorites {
+				if favorite.Channel != nil {
+					add(favorite.Channel)
+				}
+			}
+		}
+		for attempt := 0; len(candidates) < maxPollCandidates && attempt < 3*maxPollCandidates; attempt++ {
+			id, err := r.GetRandomChannel(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if dead, err := r.IsChannelDead(ctx, strconv.FormatInt(id, 10)); err != nil {
+				log.Printf("Error checking channel health: %v\n", err)
+			} else if dead {
+				continue
+			}
+			channel, err := r.GetChannelByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			add(channel)
+		}
+	}
+	return candidates, nil
+}
+
+// tally returns the votes of every candidate, p must be locked.
+func (p *poll) tally() []int {
+	tally := make([]int, len(p.candidates))
+	for _, n := range p.ballots {
+		tally[n]++
+	}
+	return tally
+}
+
+// render builds the poll message with the live tally, p must be locked.
+func (p *poll) render() (string, []discordgo.MessageComponent) {
+	content := fmt.Sprintf("**Poll:** %s asks what to watch next, closes <t:%d:R>\n%s",
+		interactionUser(p.interaction).Username, p.deadline.Unix(), p.formatTally())
+
+	buttons := make([]discordgo.MessageComponent, 0, len(p.candidates))
+	for n, channel := range p.candidates {
+		buttons = append(buttons, discordgo.Button{
+			Label:    truncateName(fmt.Sprintf("%d. %s", n+1, channel.Name), maxButtonLabelLen),
+			Style:    discordgo.PrimaryButton,
+			CustomID: fmt.Sprintf("poll:pick:%s:%d", p.id, n),
+		})
+	}
+	return content, []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// formatTally lists the candidates with their votes, p must be locked.
+func (p *poll) formatTally() string {
+	tally := p.tally()
+	lines := make([]string, 0, len(p.candidates))
+	for n, channel := range p.candidates {
+		lines = append(lines, fmt.Sprintf("%d. %s - %s: %d", n+1, channel.ID, channel.Name, tally[n]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// winner returns the candidate with the most votes, a tie is broken at random,
+// and nil when nobody voted. p must be locked.
+func (p *poll) winner() (*models.TvChannel, int) {
+	tally := p.tally()
+	best := slices.Max(tally)
+	if best == 0 {
+		return nil, 0
+	}
+	var tied []int
+	for n, votes := range tally {
+		if votes == best {
+			tied = append(tied, n)
+		}
+	}
+	return &p.candidates[tied[rand.Intn(len(tied))]], best
+}
+
+// pollComponentHandler records a ballot of a viewer. Custom IDs are
+// "poll:pick:<id>:<candidate>", voting again moves the ballot.
+func pollComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action, args string) {
+	id, choice, _ := strings.Cut(args, ":")
+	n, err := strconv.Atoi(choice)
+	if action != "pick" || err != nil {
+		log.Printf("Unknown component: %s\n", i.MessageComponentData().CustomID)
+		return
+	}
+	user := interactionUser(i)
+	// Without a TV voice channel configured nobody counts as a viewer
+	if presence != nil && !presence.IsViewer(user.ID) {
+		respondEphemeral(s, i, "Only people in the TV voice channel can vote")
+		return
+	}
+
+	votesMu.Lock()
+	p := activePoll
+	if p == nil || p.id != id || p.closed || n < 0 || n >= len(p.candidates) {
+		votesMu.Unlock()
+		respondEphemeral(s, i, "This poll is over")
+		return
+	}
+	if previous, ok := p.ballots[user.ID]; ok && previous == n {
+		votesMu.Unlock()
+		respondEphemeral(s, i, fmt.Sprintf("You already voted for %s", p.candidates[n].Name))
+		return
+	}
+	p.ballots[user.ID] = n
+	content, components := p.render()
+	votesMu.Unlock()
+	log.Printf("Poll %s: %s voted for %s", id, user.Username, p.candidates[n].Name)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to component: %v\n", err)
+	}
+}
+
+// closePoll closes the poll once its time is up and plays the winner, on
+// behalf of whoever opened the poll and with the result in the history. A DJ
+// lock held by someone else keeps the channel.
+func closePoll(s *discordgo.Session, r *models.RedisStore, p *poll) {
+	votesMu.Lock()
+	if p.closed {
+		votesMu.Unlock()
+		return
+	}
+	p.closed = true
+	if activePoll == p {
+		activePoll = nil
+	}
+	winner, votes := p.winner()
+	total := len(p.ballots)
+	tally := p.formatTally()
+	votesMu.Unlock()
+
+	if winner == nil {
+		log.Printf("Poll %s closed without votes", p.id)
+		editPollMessage(s, p, fmt.Sprintf("**Poll closed:** nobody voted, the TV stays as it is\n%s", tally))
+		return
+	}
+	log.Printf("Poll %s closed, %s won with %d of %d votes", p.id, winner.Name, votes, total)
+	result := fmt.Sprintf("**Poll closed:** %s - %s won with %d of %d votes\n%s", winner.ID, winner.Name, votes, total, tally)
+	editPollMessage(s, p, result)
+
+	requester := interactionUser(p.interaction)
+	ctx := models.WithRequester(context.Background(), models.Requester{
+		UserID:   requester.ID,
+		UserName: requester.Username,
+		GuildID:  p.interaction.GuildID,
+	})
+	if lock := djLockHolder(ctx, r, p.interaction); lock != nil {
+		editPollMessage(s, p, fmt.Sprintf("%s\n\n%s is the DJ until <t:%d:t>, the channel stays as it is",
+			result, lock.UserName, lock.Until.Unix()))
+		return
+	}
+	ctx = models.WithHistoryNote(ctx, fmt.Sprintf("won a poll with %d of %d votes", votes, total))
+	editPollMessage(s, p, result+"\n\n"+playChannel(ctx, r, winner))
+}
+
+func editPollMessage(s *discordgo.Session, p *poll, content string) {
+	content = truncateContent(content)
+	_, err := s.InteractionResponseEdit(p.interaction.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		log.Printf("Error editing poll message: %v\n", err)
+	}
+}
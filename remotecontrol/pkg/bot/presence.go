@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Presence tracks who is in the TV voice channel, fed by the voice states of
+// GuildCreate and every VoiceStateUpdate. Bots and the streamer account are
+// not viewers.
+type Presence struct {
+	TVChannelID    string
+	StreamerUserID string
+
+	mu sync.RWMutex
+	// Discord user ID to the viewers in the TV channel
+	viewers   map[string]Viewer
+	streaming bool
+	listeners []func(PresenceChange)
+}
+
+type Viewer struct {
+	UserID   string
+	UserName string
+	GuildID  string
+}
+
+// PresenceChange is a viewer joining or leaving the TV channel, or the whole
+// channel being loaded when the bot connects.
+type PresenceChange struct {
+	Viewer Viewer
+	Joined bool
+	Synced bool
+	// Viewers after the change
+	Count int
+}
+
+// NewPresence creates a Presence from the environment: DISCORD_TV_CHANNEL_ID
+// and DISCORD_STREAMER_USER_ID.
+func NewPresence() (*Presence, error) {
+	p := &Presence{viewers: make(map[string]Viewer)}
+
+	for env, target := range map[string]*string{
+		"DISCORD_TV_CHANNEL_ID":    &p.TVChannelID,
+		"DISCORD_STREAMER_USER_ID": &p.StreamerUserID,
+	} {
+		v, ok := os.LookupEnv(env)
+		if !ok || v == "" {
+			return nil, fmt.Errorf("%s environment variable is not set", env)
+		}
+		*target = v
+	}
+	return p, nil
+}
+
+// OnChange registers a function called after every viewer join or leave, and
+// once the TV channel is loaded.
+func (p *Presence) OnChange(listener func(PresenceChange)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+// ViewerCount returns how many people are watching.
+func (p *Presence) ViewerCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.viewers)
+}
+
+// Viewers returns the people watching.
+func (p *Presence) Viewers() []Viewer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	viewers := make([]Viewer, 0, len(p.viewers))
+	for _, viewer := range p.viewers {
+		viewers = append(viewers, viewer)
+	}
+	return viewers
+}
+
+// IsViewer reports whether the user is in the TV channel.
+func (p *Presence) IsViewer(userID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.viewers[userID]
+	return ok
+}
+
+// StreamerConnected reports whether the streamer account is in the TV channel.
+func (p *Presence) StreamerConnected() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.streaming
+}
+
+func (p *Presence) guildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if !slices.ContainsFunc(g.Channels, func(c *discordgo.Channel) bool { return c.ID == p.TVChannelID }) {
+		return
+	}
+
+	// Voice states in GuildCreate come without their member
+	members := make(map[string]*discordgo.Member, len(g.Members))
+	for _, member := range g.Members {
+		if member.User != nil {
+			members[member.User.ID] = member
+		}
+	}
+
+	p.mu.Lock()
+	p.streaming = false
+	for id, viewer := range p.viewers {
+		if viewer.GuildID == g.ID {
+			delete(p.viewers, id)
+		}
+	}
+	for _, vs := range g.VoiceStates {
+		member := vs.Member
+		if member == nil {
+			member = members[vs.UserID]
+		}
+		p.set(g.ID, vs.UserID, vs.ChannelID, member)
+	}
+	change := PresenceChange{Synced: true, Count: len(p.viewers)}
+	listeners := p.listeners
+	p.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
+
+func (p *Presence) voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	p.mu.Lock()
+	change, changed := p.set(v.GuildID, v.UserID, v.ChannelID, v.Member)
+	listeners := p.listeners
+	p.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
+
+// set records the voice channel of a user, p.mu must be held. It reports
+// whether a viewer joined or left.
+func (p *Presence) set(guildID, userID, channelID string, member *discordgo.Member) (PresenceChange, bool) {
+	if userID == p.StreamerUserID {
+		p.streaming = channelID == p.TVChannelID
+		return PresenceChange{}, false
+	}
+	if member != nil && member.User != nil && member.User.Bot {
+		return PresenceChange{}, false
+	}
+
+	viewer, watching := p.viewers[userID]
+	if channelID == p.TVChannelID {
+		if watching {
+			return PresenceChange{}, false
+		}
+		viewer = Viewer{UserID: userID, UserName: userID, GuildID: guildID}
+		if member != nil && member.User != nil {
+			viewer.UserName = member.User.Username
+		}
+		p.viewers[userID] = viewer
+		return PresenceChange{Viewer: viewer, Joined: true, Count: len(p.viewers)}, true
+	}
+
+	if !watching {
+		return PresenceChange{}, false
+	}
+	delete(p.viewers, userID)
+	return PresenceChange{Viewer: viewer, Count: len(p.viewers)}, true
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// queueCommand answers the /queue add|list|remove|clear subcommands.
+func queueCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	sub := i.ApplicationCommandData().Options[0]
+	log.Printf("Queue %s command received from user: %s", sub.Name, interactionUser(i).Username)
+
+	switch sub.Name {
+	case "add":
+		mediaURL := strings.TrimSpace(sub.Options[0].StringValue())
+		if u, err := url.Parse(mediaURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			respondEphemeral(s, i, "That is not a valid URL")
+			return
+		}
+
+		// Looking up the Youtube title and starting playback take a while
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
+		}
+
+		item, position, err := r.Enqueue(ctx, mediaURL)
+		if err != nil {
+			log.Printf("Error adding to queue: %v\n", err)
+			sendFollowup(s, i, fmt.Sprintf("Failed to add to the queue: %v", err))
+			return
+		}
+
+		state, err := r.GetPlayback(ctx)
+		if err != nil {
+			log.Printf("Error getting playback state: %v\n", err)
+		}
+		if state != nil && !state.Playing {
+			// Nothing on, start the queue right away
+			if _, err := r.PlayNext(ctx); err != nil {
+				log.Printf("Error playing next queue item: %v\n", err)
+				sendFollowup(s, i, "Added to the queue but failed to start it, try /skip")
+				return
+			}
+			sendFollowup(s, i, fmt.Sprintf("Playing %s", item.Title))
+			return
+		}
+		sendFollowup(s, i, fmt.Sprintf("Queued %s at position %d", item.Title, position))
+	case "list":
+		content, err := renderQueue(ctx, r)
+		if err != nil {
+			log.Printf("Error getting queue: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	case "remove":
+		position := sub.Options[0].IntValue()
+		item, err := r.RemoveFromQueue(ctx, position)
+		if err != nil {
+			log.Printf("Error removing from queue: %v\n", err)
+			respondEphemeral(s, i, fmt.Sprintf("Nothing at position %d", position))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("Removed %s from the queue", item.Title))
+	case "clear":
+		n, err := r.ClearQueue(ctx)
+		if err != nil {
+			log.Printf("Error clearing queue: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Queue cleared, %d items removed", n),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	}
+}
+
+// skipCommand answers /skip by playing the next item of the queue.
+func skipCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	log.Printf("Skip command received from user: %s", interactionUser(i).Username)
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error acknowledging interaction: %v\n", err)
+		return
+	}
+
+	next, err := r.PlayNext(ctx)
+	if err != nil {
+		log.Printf("Error playing next queue item: %v\n", err)
+		sendFollowup(s, i, "Failed to process command")
+		return
+	}
+	if next == nil {
+		sendFollowup(s, i, "The queue is empty")
+		return
+	}
+	sendFollowup(s, i, fmt.Sprintf("Playing %s", next.Title))
+}
+
+func renderQueue(ctx context.Context, r *models.RedisStore) (string, error) {
+	current, err := r.GetQueueCurrent(ctx)
+	if err != nil {
+		return "", err
+	}
+	queue, err := r.GetQueue(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current == nil && len(queue) == 0 {
+		return "The queue is empty, add something with /queue add", nil
+	}
+
+	content := ""
+	if current != nil {
+		content += fmt.Sprintf("Now: %s\n", current.Title)
+	}
+	if len(queue) == 0 {
+		content += "Nothing else queued"
+	}
+	for n, item := range queue {
+		line := fmt.Sprintf("`%d.` %s", n+1, item.Title)
+		if item.UserName != "" {
+			line += fmt.Sprintf(" (%s)", item.UserName)
+		}
+		content += line + "\n"
+	}
+	return truncateContent(content), nil
+}
@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// Panels are refreshed on every playback change and also periodically, so
+// the programme airing now stays current.
+const panelRefreshInterval = 5 * time.Minute
+
+// remoteCommand posts a remote panel in the channel of the interaction. Only
+// one panel is kept per channel, the previous one is deleted.
+func remoteCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	log.Printf("Remote command received from user: %s", interactionUser(i).Username)
+
+	embed, components := renderPanel(ctx, r)
+	msg, err := s.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		log.Printf("Error sending remote panel: %v\n", err)
+		respondEphemeral(s, i, "Failed to post the remote, check the bot can send messages here")
+		return
+	}
+
+	previous, err := r.SavePanel(ctx, i.ChannelID, msg.ID)
+	if err != nil {
+		log.Printf("Error saving remote panel: %v\n", err)
+	}
+	if previous != "" && previous != msg.ID {
+		if err := s.ChannelMessageDelete(i.ChannelID, previous); err != nil {
+			log.Printf("Error deleting previous remote panel: %v\n", err)
+		}
+	}
+
+	respondEphemeral(s, i, "Remote posted")
+}
+
+// remoteComponentHandler handles the buttons of a remote panel. Custom IDs are
+// "remote:<action>". The panel itself is refreshed by WatchPanels.
+func remoteComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action string) {
+	log.Printf("Remote %s received from user: %s", action, interactionUser(i).Username)
+
+	if action == "favorites" {
+		remoteFavorites(ctx, s, i, r)
+		return
+	}
+
+	// Switching channels takes longer than Discord waits for an answer
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Printf("Error responding to component: %v\n", err)
+		return
+	}
+
+	switch action {
+	case "up", "down":
+		currentID, err := r.GetCurrentChannelID(ctx)
+		if err != nil {
+			log.Printf("Error getting current channel: %v\n", err)
+		}
+		channel, err := r.AdjacentChannel(ctx, currentID, action == "up", "")
+		if err != nil {
+			log.Printf("Error getting adjacent channel: %v\n", err)
+			sendFollowup(s, i, "Failed to process command")
+			return
+		}
+		playChannel(ctx, r, channel)
+	case "random":
+		if _, err := r.RandomChannel(ctx); err != nil {
+			log.Printf("Error sending command to redis: %v\n", err)
+			sendFollowup(s, i, "Failed to process command")
+		}
+	case "stop":
+		if err := r.Stop(ctx); err != nil {
+			log.Printf("Error sending command to redis: %v\n", err)
+			sendFollowup(s, i, "Failed to process command")
+		}
+	case "restart":
+		restartTV(ctx, r)
+	default:
+		log.Printf("Unknown remote action: %s\n", action)
+	}
+}
+
+// remoteFavorites shows who pressed the favorites button their favorites
+// followed by the server ones, privately.
+func remoteFavorites(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	favorites, err := r.GetFavorites(ctx, models.FavoritesUser, interactionUser(i).ID)
+	if err != nil {
+		log.Printf("Error getting favorites: %v\n", err)
+		respondEphemeral(s, i, "Failed to process command")
+		return
+	}
+	if i.GuildID != "" {
+		shared, err := r.GetFavorites(ctx, models.FavoritesGuild, i.GuildID)
+		if err != nil {
+			log.Printf("Error getting favorites: %v\n", err)
+		}
+		for _, f := range shared {
+			duplicate := false
+			for _, own := range favorites {
+				if own.Ref == f.Ref || (own.Channel != nil && f.Channel != nil && own.Channel.ID == f.Channel.ID) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				favorites = append(favorites, f)
+			}
+		}
+	}
+
+	data := renderFavorites(favorites, "Favorites")
+	data.Flags = discordgo.MessageFlagsEphemeral
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error responding to component: %v\n", err)
+	}
+}
+
+// renderPanel builds the embed and buttons of a remote panel from the current
+// playback state.
+func renderPanel(ctx context.Context, r *models.RedisStore) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	state, err := r.GetPlayback(ctx)
+	if err != nil {
+		log.Printf("Error getting playback state: %v\n", err)
+		state = &models.PlaybackState{}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: "TV remote",
+	}
+	switch {
+	case state.Playing && state.ChannelID != "":
+		embed.Description = fmt.Sprintf("**Now playing:** `%s` %s", state.ChannelID, state.Title)
+		if current, _, err := r.GetNowNext(ctx, state.ChannelID); err != nil {
+			log.Printf("Error getting programme: %v\n", err)
+		} else if current != nil {
+			embed.Description += fmt.Sprintf("\nNow: %s", formatProgramme(current))
+		}
+	case state.Playing:
+		embed.Description = fmt.Sprintf("**Now playing:** %s (Youtube)", state.Title)
+	default:
+		embed.Description = "**TV is off**"
+		if current, err := r.GetCurrentChannel(ctx); err == nil {
+			embed.Description += fmt.Sprintf("\nLast channel: `%s` %s", current.ID, current.Name)
+		}
+	}
+	if !state.UpdatedAt.IsZero() {
+		embed.Timestamp = state.UpdatedAt.Format(time.RFC3339)
+	}
+	if presence != nil {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d watching", presence.ViewerCount())}
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Ch -", Style: discordgo.PrimaryButton, CustomID: "remote:down"},
+				discordgo.Button{Label: "Ch +", Style: discordgo.PrimaryButton, CustomID: "remote:up"},
+				discordgo.Button{Label: "Random", Style: discordgo.SecondaryButton, CustomID: "remote:random"},
+				discordgo.Button{Label: "Restart", Style: discordgo.SecondaryButton, CustomID: "remote:restart"},
+				discordgo.Button{Label: "Stop", Style: discordgo.DangerButton, CustomID: "remote:stop", Disabled: !state.Playing},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Favorites", Style: discordgo.SuccessButton, CustomID: "remote:favorites"},
+			},
+		},
+	}
+	return embed, components
+}
+
+// WatchPanels keeps every remote panel in sync with the playback state until
+// the context is cancelled.
+func WatchPanels(ctx context.Context, s *discordgo.Session) {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v\n", err)
+		return
+	}
+	r.Prefix = "channel"
+
+	pubsub := r.SubscribePlayback(ctx)
+	defer pubsub.Close()
+	updates := pubsub.Channel()
+
+	// The viewer count is on the panel too
+	viewersChanged := make(chan struct{}, 1)
+	if presence != nil {
+		presence.OnChange(func(PresenceChange) {
+			select {
+			case viewersChanged <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	ticker := time.NewTicker(panelRefreshInterval)
+	defer ticker.Stop()
+
+	refreshPanels(ctx, s, r)
+	for {
+		select {
+		case <-updates:
+			refreshPanels(ctx, s, r)
+		case <-viewersChanged:
+			refreshPanels(ctx, s, r)
+		case <-ticker.C:
+			refreshPanels(ctx, s, r)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshPanels edits every panel, forgetting the ones deleted from Discord.
+func refreshPanels(ctx context.Context, s *discordgo.Session, r *models.RedisStore) {
+	panels, err := r.GetPanels(ctx)
+	if err != nil {
+		log.Printf("Error getting remote panels: %v\n", err)
+		return
+	}
+	if len(panels) == 0 {
+		return
+	}
+
+	embed, components := renderPanel(ctx, r)
+	for channelID, messageID := range panels {
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Channel:    channelID,
+			ID:         messageID,
+			Embeds:     &[]*discordgo.MessageEmbed{embed},
+			Components: &components,
+		})
+		if err == nil {
+			continue
+		}
+
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil &&
+			(restErr.Response.StatusCode == http.StatusNotFound || restErr.Response.StatusCode == http.StatusForbidden) {
+			log.Printf("Remote panel %s/%s is gone, forgetting it", channelID, messageID)
+			if err := r.DeletePanel(ctx, channelID, messageID); err != nil {
+				log.Printf("Error deleting remote panel: %v\n", err)
+			}
+			continue
+		}
+		log.Printf("Error updating remote panel: %v\n", err)
+	}
+}
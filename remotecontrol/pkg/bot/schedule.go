@@ -0,0 +1,362 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/scheduler"
+)
+
+// How far ahead the guide is searched for a programme. Searching every
+// channel is heavy, so without a channel only the next day is.
+const (
+	programmeSearchWindow        = 24 * time.Hour
+	channelProgrammeSearchWindow = 7 * 24 * time.Hour
+)
+
+// Day of week field of the cron expression of every repeat choice, weekly
+// repeats on the weekday of the first run
+var repeatDays = map[string]string{
+	"daily":    "*",
+	"weekdays": "1-5",
+	"weekends": "0,6",
+}
+
+// scheduleCommand answers the /schedule add|list|cancel subcommands.
+func scheduleCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	sub := i.ApplicationCommandData().Options[0]
+	options := subcommandOptions(i)
+	log.Printf("Schedule %s command received from user: %s - %v", sub.Name, interactionUser(i).Username, options)
+
+	switch sub.Name {
+	case "add":
+		job, problem := newScheduledJob(ctx, r, options)
+		if job == nil {
+			respondEphemeral(s, i, problem)
+			return
+		}
+		job.Moderator = isModerator(permissions.guild(i.GuildID), i.Member)
+		err := r.AddScheduledJob(ctx, job)
+		if err != nil {
+			log.Printf("Error adding scheduled job: %v\n", err)
+			respondEphemeral(s, i, fmt.Sprintf("Failed to schedule: %v", err))
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Scheduled: " + formatScheduledJob(job),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	case "list":
+		jobs, err := r.GetScheduledJobs(ctx)
+		if err != nil {
+			log.Printf("Error getting scheduled jobs: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		content := "Nothing is scheduled, add something with /schedule add"
+		if len(jobs) > 0 {
+			lines := make([]string, 0, len(jobs))
+			for n := range jobs {
+				lines = append(lines, formatScheduledJob(&jobs[n]))
+			}
+			content = strings.Join(lines, "\n")
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: truncateContent(content),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	case "cancel":
+		id := strings.TrimSpace(options["job"])
+		job, err := r.GetScheduledJob(ctx, id)
+		if err != nil {
+			log.Printf("Error getting scheduled job: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		if job == nil {
+			respondEphemeral(s, i, fmt.Sprintf("Nothing is scheduled with ID %s, see /schedule list", id))
+			return
+		}
+		if job.UserID != interactionUser(i).ID && !isModerator(permissions.guild(i.GuildID), i.Member) {
+			respondEphemeral(s, i, fmt.Sprintf("Only %s or a moderator can cancel it", job.UserName))
+			return
+		}
+		if err := r.DeleteScheduledJob(ctx, job.ID); err != nil {
+			log.Printf("Error deleting scheduled job: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Canceled: " + formatScheduledJob(job),
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to command: %v\n", err)
+		}
+	}
+}
+
+// subcommandOptions returns the string options of the subcommand of an
+// interaction by name.
+func subcommandOptions(i *discordgo.InteractionCreate) map[string]string {
+	options := make(map[string]string)
+	for _, option := range i.ApplicationCommandData().Options[0].Options {
+		options[option.Name] = option.StringValue()
+	}
+	return options
+}
+
+// newScheduledJob builds the job /schedule add asks for, or returns what is
+// wrong with the options for the user.
+func newScheduledJob(ctx context.Context, r *models.RedisStore, options map[string]string) (*models.ScheduledJob, string) {
+	job := &models.ScheduledJob{
+		Action:   models.ScheduleActionPlay,
+		Timezone: strings.TrimSpace(options["timezone"]),
+	}
+	if options["action"] == models.ScheduleActionStop {
+		job.Action = models.ScheduleActionStop
+	}
+	loc, err := scheduler.LoadLocation(job.Timezone)
+	if err != nil {
+		return nil, fmt.Sprintf("Unknown time zone %q, use a name like America/Sao_Paulo", job.Timezone)
+	}
+
+	var channel *models.TvChannel
+	if value := options["channel"]; value != "" {
+		channel, err = resolveChannel(ctx, r, value)
+		if err != nil {
+			log.Printf("Error resolving channel: %v\n", err)
+			return nil, fmt.Sprintf("Channel %s not found", value)
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case options["programme"] != "":
+		if repeat := options["repeat"]; repeat != "" && repeat != "once" {
+			return nil, "Programmes can only be scheduled once, their times change"
+		}
+		programmes, err := findProgrammes(ctx, r, options["programme"], channel, now)
+		if err != nil {
+			log.Printf("Error searching programmes: %v\n", err)
+			return nil, "Failed to search the guide"
+		}
+		if len(programmes) == 0 {
+			return nil, fmt.Sprintf("No programme matching %q in the guide", options["programme"])
+		}
+		programme := programmes[0]
+		if job.Action == models.ScheduleActionStop {
+			job.Programme = programme.Programme.Title
+			job.Next = programme.Programme.Stop
+			break
+		}
+		// Playing something airing already is a job for /tv
+		upcoming := slices.IndexFunc(programmes, func(p models.ChannelProgramme) bool { return p.Programme.Start.After(now) })
+		if upcoming < 0 {
+			return nil, fmt.Sprintf("%s already started, use /tv", programme.Programme.Title)
+		}
+		programme = programmes[upcoming]
+		job.Programme = programme.Programme.Title
+		job.Next = programme.Programme.Start
+		if channel == nil || channel.ID != programme.ChannelID {
+			channel, err = r.GetChannelByID(ctx, mustParseID(programme.ChannelID))
+			if err != nil {
+				log.Printf("Error getting channel: %v\n", err)
+				return nil, fmt.Sprintf("Channel %s of %s not found", programme.ChannelID, programme.Programme.Title)
+			}
+		}
+	case options["at"] != "":
+		job.Next, job.Cron, err = parseWhen(options["at"], options["repeat"], loc, now)
+		if err != nil {
+			return nil, fmt.Sprintf("Can't schedule at %q: %v", options["at"], err)
+		}
+	default:
+		return nil, "Say when with the at option, or pick a programme"
+	}
+
+	if job.Action == models.ScheduleActionPlay {
+		if channel == nil {
+			return nil, "Say which channel to play with the channel option"
+		}
+		job.ChannelID = channel.ID
+		job.ChannelName = channel.Name
+	}
+	return job, ""
+}
+
+// parseWhen returns the first run and the cron expression of a job from the
+// at option, a time of day, a date and time or a cron expression, and the
+// repeat option.
+func parseWhen(at, repeat string, loc *time.Location, now time.Time) (time.Time, string, error) {
+	at = strings.TrimSpace(at)
+	once := repeat == "" || repeat == "once"
+	if len(strings.Fields(at)) == 5 {
+		if !once {
+			return time.Time{}, "", fmt.Errorf("cron expressions repeat on their own, leave repeat empty")
+		}
+		cron, err := scheduler.ParseCron(at)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		next := cron.Next(now.In(loc))
+		if next.IsZero() {
+			return time.Time{}, "", fmt.Errorf("it never runs")
+		}
+		return next, at, nil
+	}
+
+	var t time.Time
+	if clock, err := time.ParseInLocation("15:04", at, loc); err == nil {
+		year, month, day := now.In(loc).Date()
+		t = time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc)
+		if !t.After(now) {
+			t = time.Date(year, month, day+1, clock.Hour(), clock.Minute(), 0, 0, loc)
+		}
+	} else if t, err = time.ParseInLocation("2006-01-02 15:04", at, loc); err != nil {
+		return time.Time{}, "", fmt.Errorf(`use a time like "21:45", a date like "2026-10-20 21:45" or a cron expression like "45 21 * * 1-5"`)
+	} else if !t.After(now) {
+		return time.Time{}, "", fmt.Errorf("that time already passed")
+	}
+	if once {
+		return t, "", nil
+	}
+
+	days, ok := repeatDays[repeat]
+	if !ok {
+		days = strconv.Itoa(int(t.Weekday()))
+	}
+	expr := fmt.Sprintf("%d %d * * %s", t.Minute(), t.Hour(), days)
+	cron, err := scheduler.ParseCron(expr)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	// The first run is the given time, or the first matching day after it
+	return cron.Next(t.Add(-time.Minute)), expr, nil
+}
+
+// findProgrammes returns the programmes a /schedule programme option points
+// to: an autocomplete choice, "<channel id>@<start unix time>", or the
+// programmes airing now or later whose title matches.
+func findProgrammes(ctx context.Context, r *models.RedisStore, value string, channel *models.TvChannel, now time.Time) ([]models.ChannelProgramme, error) {
+	if channelID, start, ok := strings.Cut(value, "@"); ok {
+		if unix, err := strconv.ParseInt(start, 10, 64); err == nil {
+			at := time.Unix(unix, 0)
+			programmes, err := r.SearchUpcomingProgrammes(ctx, "", channelID, at, at)
+			if err != nil || len(programmes) > 0 {
+				return programmes, err
+			}
+		}
+	}
+	return searchProgrammes(ctx, r, value, channel, now)
+}
+
+// searchProgrammes returns the programmes airing now or later whose title
+// matches, soonest first.
+func searchProgrammes(ctx context.Context, r *models.RedisStore, query string, channel *models.TvChannel, now time.Time) ([]models.ChannelProgramme, error) {
+	channelID := ""
+	window := programmeSearchWindow
+	if channel != nil {
+		channelID = channel.ID
+		window = channelProgrammeSearchWindow
+	}
+	// Programmes airing now started up to a few hours ago
+	programmes, err := r.SearchUpcomingProgrammes(ctx, query, channelID, now.Add(-12*time.Hour), now.Add(window))
+	if err != nil {
+		return nil, err
+	}
+	airing := programmes[:0]
+	for _, p := range programmes {
+		if p.Programme.Stop.After(now) {
+			airing = append(airing, p)
+		}
+	}
+	return airing, nil
+}
+
+// formatScheduledJob formats a job as "<when> WHAT, REPEAT by USER (ID)".
+func formatScheduledJob(job *models.ScheduledJob) string {
+	line := fmt.Sprintf("<t:%d:f> %s", job.Next.Unix(), scheduler.Describe(job))
+	if job.Cron != "" {
+		line += fmt.Sprintf(", repeats `%s`", job.Cron)
+		if job.Timezone != "" {
+			line += fmt.Sprintf(" %s time", job.Timezone)
+		}
+	}
+	if job.UserName != "" {
+		line += fmt.Sprintf(" by %s", job.UserName)
+	}
+	return line + fmt.Sprintf(" (`%s`)", job.ID)
+}
+
+// scheduleChoices suggests the scheduled jobs for /schedule cancel.
+func scheduleChoices(ctx context.Context, r *models.RedisStore, query string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	jobs, err := r.GetScheduledJobs(ctx)
+	if err != nil {
+		log.Printf("Error getting scheduled jobs: %v\n", err)
+		return choices
+	}
+	for n := range jobs {
+		job := &jobs[n]
+		name := fmt.Sprintf("%s %s", job.Next.Local().Format("Mon Jan 2 15:04"), scheduler.Describe(job))
+		if query != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(query)) && job.ID != query {
+			continue
+		}
+		if len(choices) == maxChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateChoiceName(name),
+			Value: job.ID,
+		})
+	}
+	return choices
+}
+
+// programmeChoices suggests the programmes of the guide matching the query
+// for /schedule add, on the chosen channel when there is one.
+func programmeChoices(ctx context.Context, r *models.RedisStore, query, channelValue string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	var channel *models.TvChannel
+	if channelValue != "" {
+		channel, _ = resolveChannel(ctx, r, channelValue)
+	}
+	if query == "" && channel == nil {
+		return choices
+	}
+
+	programmes, err := searchProgrammes(ctx, r, query, channel, time.Now())
+	if err != nil {
+		log.Printf("Error searching programmes: %v\n", err)
+		return choices
+	}
+	for _, p := range programmes {
+		if len(choices) == maxChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateChoiceName(fmt.Sprintf("%s %s - %s", p.Programme.Start.Local().Format("Mon 15:04"), p.ChannelID, p.Programme.Title)),
+			Value: fmt.Sprintf("%s@%d", p.ChannelID, p.Programme.Start.Unix()),
+		})
+	}
+	return choices
+}
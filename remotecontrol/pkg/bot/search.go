@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const (
+	searchSessionKind = "search"
+	// A select menu holds at most 25 options, keep pages readable
+	searchPageSize = 10
+)
+
+// searchCommand answers /search with the first page of results.
+func searchCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	query := i.ApplicationCommandData().Options[0].StringValue()
+	log.Printf("Search command received from user: %s - query: %s", interactionUser(i).Username, query)
+
+	session := &models.SearchSession{
+		ID:          models.NewSessionID(),
+		Query:       query,
+		RequesterID: interactionUser(i).ID,
+	}
+	data, err := renderSearchPage(ctx, r, session)
+	if err != nil {
+		log.Printf("Error searching for channel: %v\n", err)
+		respondEphemeral(s, i, "Failed to process command")
+		return
+	}
+	if err := r.SaveSession(ctx, searchSessionKind, session.ID, session); err != nil {
+		log.Printf("Error saving search session: %v\n", err)
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Error responding to command: %v\n", err)
+	}
+}
+
+// searchComponentHandler handles the page buttons and the channel select menu
+// of a search result. Custom IDs are "search:<action>:<session id>".
+func searchComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action, sessionID string) {
+	session := &models.SearchSession{}
+	if err := r.GetSession(ctx, searchSessionKind, sessionID, session); err != nil {
+		if err != models.ErrSessionExpired {
+			log.Printf("Error loading search session: %v\n", err)
+		}
+		respondEphemeral(s, i, "This search expired, run /search again")
+		return
+	}
+
+	switch action {
+	case "prev", "next":
+		if interactionUser(i).ID != session.RequesterID {
+			respondEphemeral(s, i, "Only who searched can change pages, run your own /search")
+			return
+		}
+		if action == "prev" {
+			session.Page--
+		} else {
+			session.Page++
+		}
+		session.Page = max(session.Page, 0)
+
+		data, err := renderSearchPage(ctx, r, session)
+		if err != nil {
+			log.Printf("Error searching for channel: %v\n", err)
+			respondEphemeral(s, i, "Failed to process command")
+			return
+		}
+		if err := r.SaveSession(ctx, searchSessionKind, session.ID, session); err != nil {
+			log.Printf("Error saving search session: %v\n", err)
+		}
+
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: data,
+		})
+		if err != nil {
+			log.Printf("Error responding to component: %v\n", err)
+		}
+	case "play":
+		values := i.MessageComponentData().Values
+		if len(values) == 0 {
+			return
+		}
+		log.Printf("Search play received from user: %s - channel: %s", interactionUser(i).Username, values[0])
+
+		channel, err := r.GetChannelByID(ctx, mustParseID(values[0]))
+		if err != nil {
+			log.Printf("Error getting channel by ID: %v\n", err)
+			respondEphemeral(s, i, fmt.Sprintf("Channel %s not found", values[0]))
+			return
+		}
+
+		// Switching channels takes longer than Discord waits for an answer
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			log.Printf("Error acknowledging interaction: %v\n", err)
+			return
+		}
+		sendFollowup(s, i, playChannel(ctx, r, channel))
+	default:
+		log.Printf("Unknown search action: %s\n", action)
+	}
+}
+
+// renderSearchPage builds the embed, page buttons and select menu of the
+// current page of a search session.
+func renderSearchPage(ctx context.Context, r *models.RedisStore, session *models.SearchSession) (*discordgo.InteractionResponseData, error) {
+	result, err := r.SearchChannels(ctx, session.Query, session.Page, searchPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if result.Total == 0 {
+		return &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("No channels found for %q", session.Query),
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		}, nil
+	}
+	// The catalog may have shrunk since the last click
+	if session.Page >= result.Pages() {
+		session.Page = result.Pages() - 1
+		if result, err = r.SearchChannels(ctx, session.Query, session.Page, searchPageSize); err != nil {
+			return nil, err
+		}
+	}
+
+	dead, err := r.GetDeadChannels(ctx)
+	if err != nil {
+		log.Printf("Error getting channel health: %v\n", err)
+	}
+
+	var lines []string
+	options := make([]discordgo.SelectMenuOption, 0, len(result.Channels))
+	for _, channel := range result.Channels {
+		label := truncateChoiceName(fmt.Sprintf("%s - %s", channel.ID, channel.Name))
+		option := discordgo.SelectMenuOption{Label: label, Value: channel.ID}
+		if dead[channel.ID] {
+			lines = append(lines, fmt.Sprintf("~~`%s` %s~~ (offline)", channel.ID, channel.Name))
+			option.Description = "Offline"
+		} else {
+			lines = append(lines, fmt.Sprintf("`%s` %s", channel.ID, channel.Name))
+		}
+		options = append(options, option)
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       truncateChoiceName(fmt.Sprintf("Search: %s", session.Query)),
+				Description: strings.Join(lines, "\n"),
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: fmt.Sprintf("Page %d/%d - %d channels", session.Page+1, result.Pages(), result.Total),
+				},
+			},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						CustomID:    fmt.Sprintf("search:play:%s", session.ID),
+						Placeholder: "Pick a channel to watch",
+						Options:     options,
+					},
+				},
+			},
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Previous",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("search:prev:%s", session.ID),
+						Disabled: session.Page == 0,
+					},
+					discordgo.Button{
+						Label:    "Next",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("search:next:%s", session.ID),
+						Disabled: session.Page >= result.Pages()-1,
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,363 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/scheduler"
+)
+
+const (
+	defaultVoteQuorum  = 0.5
+	defaultVoteTimeout = time.Minute
+	defaultPollTimeout = time.Minute
+	// Polls are edited through their interaction token, valid for 15 minutes
+	maxPollTimeout = 10 * time.Minute
+)
+
+// Commands put to a vote when enough people are watching
+var votable = []string{"tv", "random", "stop", "skip", "schedule add"}
+
+// VoteConfig says when channel changes go to a vote. A vote passes once
+// Quorum of the viewers present when it started voted yes, and fails when
+// Timeout passes first. Polls close after PollTimeout.
+type VoteConfig struct {
+	// Votes start when more than MinViewers are watching, a negative value
+	// disables voting
+	MinViewers int
+	Quorum     float64
+	Timeout    time.Duration
+	// How long /poll stays open
+	PollTimeout time.Duration
+}
+
+// voteConfig is loaded once by New.
+var voteConfig VoteConfig
+
+// LoadVoteConfig reads the vote config from the environment: VOTE_MIN_VIEWERS
+// (empty disables voting), VOTE_QUORUM (fraction of the viewers) and
+// VOTE_TIMEOUT and POLL_TIMEOUT (Go durations).
+func LoadVoteConfig() (VoteConfig, error) {
+	config := VoteConfig{
+		MinViewers:  -1,
+		Quorum:      defaultVoteQuorum,
+		Timeout:     defaultVoteTimeout,
+		PollTimeout: defaultPollTimeout,
+	}
+
+	if v, ok := os.LookupEnv("VOTE_MIN_VIEWERS"); ok && v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			return config, fmt.Errorf("invalid VOTE_MIN_VIEWERS: %q", v)
+		}
+		config.MinViewers = parsed
+	}
+	if v, ok := os.LookupEnv("VOTE_QUORUM"); ok && v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			return config, fmt.Errorf("invalid VOTE_QUORUM: %q", v)
+		}
+		config.Quorum = parsed
+	}
+	if v, ok := os.LookupEnv("VOTE_TIMEOUT"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("invalid VOTE_TIMEOUT: %q", v)
+		}
+		config.Timeout = parsed
+	}
+	if v, ok := os.LookupEnv("POLL_TIMEOUT"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 || parsed > maxPollTimeout {
+			return config, fmt.Errorf("invalid POLL_TIMEOUT: %q", v)
+		}
+		config.PollTimeout = parsed
+	}
+	return config, nil
+}
+
+type vote struct {
+	id          string
+	action      string
+	description string
+	// The interaction that started the vote, its response is the vote message
+	interaction *discordgo.InteractionCreate
+	run         func(ctx context.Context) string
+	needed      int
+	eligible    int
+	yes         map[string]bool
+	no          map[string]bool
+	deadline    time.Time
+	timer       *time.Timer
+	closed      bool
+}
+
+// Votes in progress by ID. They only live in memory, a vote does not outlive
+// its Discord interaction token anyway.
+var (
+	votesMu sync.Mutex
+	votes   = make(map[string]*vote)
+)
+
+// callVote puts the interaction to a vote when the action is votable and
+// enough people are watching, and reports whether it did. The action then
+// only runs if the vote passes.
+func callVote(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, action string) bool {
+	if voteConfig.MinViewers < 0 || presence == nil {
+		return false
+	}
+	// Buttons and favorites carry no channel the vote could show, /tv does
+	redirect := action == "fav play" || (action == "tv" && i.Type == discordgo.InteractionMessageComponent)
+	if !redirect && !slices.Contains(votable, action) {
+		return false
+	}
+	viewers := presence.ViewerCount()
+	if viewers <= voteConfig.MinViewers || isModerator(permissions.guild(i.GuildID), i.Member) {
+		return false
+	}
+	if redirect {
+		respondEphemeral(s, i, fmt.Sprintf("With %d people watching changing the channel goes to a vote, use /tv", viewers))
+		return true
+	}
+
+	description, run := voteProposal(ctx, i, r, action)
+	if run == nil {
+		return false
+	}
+
+	user := interactionUser(i)
+	v := &vote{
+		id:          models.NewSessionID(),
+		action:      action,
+		description: description,
+		interaction: i,
+		run:         run,
+		needed:      int(math.Max(1, math.Ceil(voteConfig.Quorum*float64(viewers)))),
+		eligible:    viewers,
+		yes:         make(map[string]bool),
+		no:          make(map[string]bool),
+		deadline:    time.Now().Add(voteConfig.Timeout),
+	}
+	if presence.IsViewer(user.ID) {
+		v.yes[user.ID] = true
+	}
+	if decided, _ := v.outcome(); decided {
+		// The vote of whoever asked is enough
+		return false
+	}
+	log.Printf("Vote %s started by %s: %s", v.id, user.Username, description)
+
+	votesMu.Lock()
+	votes[v.id] = v
+	content, components := v.render()
+	v.timer = time.AfterFunc(voteConfig.Timeout, func() { expireVote(s, r, v) })
+	votesMu.Unlock()
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to command: %v\n", err)
+	}
+	return true
+}
+
+// voteProposal describes what a votable interaction would do and returns the
+// function doing it, nil when it is not votable.
+func voteProposal(ctx context.Context, i *discordgo.InteractionCreate, r *models.RedisStore, action string) (string, func(ctx context.Context) string) {
+	switch action {
+	case "tv":
+		channel, err := resolveChannel(ctx, r, i.ApplicationCommandData().Options[0].StringValue())
+		if err != nil {
+			// The command answers that the channel does not exist
+			return "", nil
+		}
+		return fmt.Sprintf("switch to %s - %s", channel.ID, channel.Name), func(ctx context.Context) string {
+			return playChannel(ctx, r, channel)
+		}
+	case "random":
+		return "switch to a random channel", func(ctx context.Context) string {
+			channel, err := r.RandomChannel(ctx)
+			if err != nil {
+				log.Printf("Error sending command to redis: %v\n", err)
+				return "Failed to process command"
+			}
+			return fmt.Sprintf("Random channel set to %s - %s", channel.ID, channel.Name)
+		}
+	case "stop":
+		return "turn the TV off", func(ctx context.Context) string {
+			if err := r.Stop(ctx); err != nil {
+				log.Printf("Error sending command to redis: %v\n", err)
+				return "Failed to process command"
+			}
+			return "TV stopped"
+		}
+	case "schedule add":
+		job, _ := newScheduledJob(ctx, r, subcommandOptions(i))
+		if job == nil {
+			// The command answers what is wrong with it
+			return "", nil
+		}
+		return fmt.Sprintf("schedule \"%s\" at <t:%d:f>", scheduler.Describe(job), job.Next.Unix()), func(ctx context.Context) string {
+			if err := r.AddScheduledJob(ctx, job); err != nil {
+				log.Printf("Error adding scheduled job: %v\n", err)
+				return fmt.Sprintf("Failed to schedule: %v", err)
+			}
+			return "Scheduled: " + formatScheduledJob(job)
+		}
+	case "skip":
+		return "skip to the next item of the queue", func(ctx context.Context) string {
+			next, err := r.PlayNext(ctx)
+			if err != nil {
+				log.Printf("Error playing next queue item: %v\n", err)
+				return "Failed to process command"
+			}
+			if next == nil {
+				return "The queue is empty"
+			}
+			return fmt.Sprintf("Playing %s", next.Title)
+		}
+	}
+	return "", nil
+}
+
+// render builds the vote message, v must be locked.
+func (v *vote) render() (string, []discordgo.MessageComponent) {
+	content := fmt.Sprintf("**Vote:** %s wants to %s\nYes: %d · No: %d · %d yes votes needed, closes <t:%d:R>",
+		interactionUser(v.interaction).Username, v.description, len(v.yes), len(v.no), v.needed, v.deadline.Unix())
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Yes", Style: discordgo.SuccessButton, CustomID: "vote:yes:" + v.id},
+				discordgo.Button{Label: "No", Style: discordgo.DangerButton, CustomID: "vote:no:" + v.id},
+			},
+		},
+	}
+	return content, components
+}
+
+// outcome reports whether the vote is decided and if it passed, v must be
+// locked.
+func (v *vote) outcome() (decided, passed bool) {
+	if len(v.yes) >= v.needed {
+		return true, true
+	}
+	if len(v.no) > v.eligible-v.needed {
+		return true, false
+	}
+	return false, false
+}
+
+// voteComponentHandler records a vote. Custom IDs are "vote:<yes|no>:<id>".
+func voteComponentHandler(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, choice, id string) {
+	user := interactionUser(i)
+	if presence == nil || !presence.IsViewer(user.ID) {
+		respondEphemeral(s, i, "Only people in the TV voice channel can vote")
+		return
+	}
+
+	votesMu.Lock()
+	v, ok := votes[id]
+	if !ok || v.closed {
+		votesMu.Unlock()
+		respondEphemeral(s, i, "This vote is over")
+		return
+	}
+	delete(v.yes, user.ID)
+	delete(v.no, user.ID)
+	if choice == "yes" {
+		v.yes[user.ID] = true
+	} else {
+		v.no[user.ID] = true
+	}
+	log.Printf("Vote %s: %s voted %s", id, user.Username, choice)
+
+	decided, passed := v.outcome()
+	content, components := v.render()
+	if decided {
+		v.closed = true
+		v.timer.Stop()
+		delete(votes, id)
+		content = v.result(passed)
+		components = []discordgo.MessageComponent{}
+	}
+	votesMu.Unlock()
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error responding to component: %v\n", err)
+	}
+	if passed {
+		applyVote(ctx, s, r, v)
+	}
+}
+
+// expireVote closes a vote nobody decided in time.
+func expireVote(s *discordgo.Session, r *models.RedisStore, v *vote) {
+	votesMu.Lock()
+	if v.closed {
+		votesMu.Unlock()
+		return
+	}
+	v.closed = true
+	delete(votes, v.id)
+	decided, passed := v.outcome()
+	content := v.result(decided && passed)
+	votesMu.Unlock()
+
+	editVoteMessage(s, v, content)
+	if decided && passed {
+		applyVote(context.Background(), s, r, v)
+	}
+}
+
+// result is the closed vote message, v must be locked.
+func (v *vote) result(passed bool) string {
+	if passed {
+		return fmt.Sprintf("**Vote passed:** %s (%d yes, %d no)", v.description, len(v.yes), len(v.no))
+	}
+	return fmt.Sprintf("**Vote failed:** %s (%d yes, %d no, %d needed)", v.description, len(v.yes), len(v.no), v.needed)
+}
+
+// applyVote runs what the vote passed, on behalf of whoever started it.
+func applyVote(ctx context.Context, s *discordgo.Session, r *models.RedisStore, v *vote) {
+	requester := interactionUser(v.interaction)
+	ctx = models.WithRequester(ctx, models.Requester{
+		UserID:   requester.ID,
+		UserName: requester.Username,
+		GuildID:  v.interaction.GuildID,
+	})
+	generation := djLockGeneration(ctx, r, v.interaction, v.action)
+	outcome := v.run(ctx)
+	claimDJLock(ctx, r, v.interaction, v.action, generation)
+	editVoteMessage(s, v, v.result(true)+"\n"+outcome)
+}
+
+func editVoteMessage(s *discordgo.Session, v *vote, content string) {
+	_, err := s.InteractionResponseEdit(v.interaction.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		log.Printf("Error editing vote message: %v\n", err)
+	}
+}
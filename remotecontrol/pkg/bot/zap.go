@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// zapCommand answers /next and /prev by playing the channel after or before
+// the current one, optionally within the current channel's group.
+func zapCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore, forward bool) {
+	sameGroup := false
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "same_group" {
+			sameGroup = option.BoolValue()
+		}
+	}
+	log.Printf("%s command received from user: %s - same group: %t", i.ApplicationCommandData().Name, interactionUser(i).Username, sameGroup)
+
+	// Switching channels takes longer than Discord waits for an answer
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error acknowledging interaction: %v\n", err)
+		return
+	}
+
+	currentID, err := r.GetCurrentChannelID(ctx)
+	if err != nil {
+		log.Printf("Error getting current channel: %v\n", err)
+	}
+	group := ""
+	if sameGroup && currentID != "" {
+		current, err := r.GetChannelByID(ctx, mustParseID(currentID))
+		if err != nil {
+			log.Printf("Error getting current channel: %v\n", err)
+			sendFollowup(s, i, "The current channel is not in the catalog anymore, pick one with /tv")
+			return
+		}
+		group = current.Group
+	}
+
+	channel, err := r.AdjacentChannel(ctx, currentID, forward, group)
+	if errors.Is(err, models.ErrNoChannel) {
+		sendFollowup(s, i, "No other channel available")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting adjacent channel: %v\n", err)
+		sendFollowup(s, i, "Failed to process command")
+		return
+	}
+
+	sendFollowup(s, i, playChannel(ctx, r, channel))
+}
+
+// backCommand answers /back by flipping to the channel played before the
+// current one.
+func backCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, r *models.RedisStore) {
+	log.Printf("Back command received from user: %s", interactionUser(i).Username)
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error acknowledging interaction: %v\n", err)
+		return
+	}
+
+	lastID, err := r.GetLastChannelID(ctx)
+	if err != nil {
+		log.Printf("Error getting last channel: %v\n", err)
+		sendFollowup(s, i, "Failed to process command")
+		return
+	}
+	if lastID == "" {
+		sendFollowup(s, i, "No previous channel to go back to")
+		return
+	}
+
+	channel, err := r.GetChannelByID(ctx, mustParseID(lastID))
+	if err != nil {
+		log.Printf("Error getting channel by ID: %v\n", err)
+		sendFollowup(s, i, "The previous channel is not in the catalog anymore")
+		return
+	}
+
+	sendFollowup(s, i, playChannel(ctx, r, channel))
+}
@@ -0,0 +1,216 @@
+package epg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/search"
+)
+
+const (
+	defaultRefreshInterval = 12 * time.Hour
+	downloadTimeout        = 5 * time.Minute
+	// How far ahead programmes are kept
+	guideWindow = 36 * time.Hour
+)
+
+// qualityTokens are dropped when matching channel names against the guide,
+// "ESPN HD" and "ESPN FHD" are the same channel as far as the guide goes.
+var qualityTokens = map[string]bool{
+	"sd": true, "hd": true, "fhd": true, "uhd": true, "hdr": true, "hevc": true, "alt": true,
+}
+
+// qualityMarkers mixes letters and digits, search.Tokens would split them, so
+// they are removed before tokenizing.
+var qualityMarkers = regexp.MustCompile(`(?i)\b([48]k|h\.?26[45]|\d{3,4}p)\b`)
+
+// Updater periodically downloads the XMLTV guides and stores the programmes
+// of the catalog channels in Redis.
+type Updater struct {
+	URLs     []string
+	Interval time.Duration
+}
+
+// NewUpdater creates an Updater from the environment. EPG_URL is a comma
+// separated list of XMLTV URLs (plain or gzip), when it is empty the EPG is
+// disabled. EPG_REFRESH_INTERVAL sets how often the guides are downloaded.
+func NewUpdater() (*Updater, error) {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("EPG_URL"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	interval := defaultRefreshInterval
+	if v, ok := os.LookupEnv("EPG_REFRESH_INTERVAL"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EPG_REFRESH_INTERVAL: %w", err)
+		}
+		interval = parsed
+	}
+
+	return &Updater{URLs: urls, Interval: interval}, nil
+}
+
+// Run updates the guide right away and then every Interval until the context
+// is cancelled.
+func (u *Updater) Run(ctx context.Context) {
+	if len(u.URLs) == 0 {
+		log.Println("EPG_URL not set, EPG disabled")
+		return
+	}
+
+	if err := u.Update(ctx); err != nil {
+		log.Printf("EPG update failed: %v", err)
+	}
+	if u.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := u.Update(ctx); err != nil {
+				log.Printf("EPG update failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Update downloads every guide, matches its channels against the catalog and
+// stores the programmes.
+func (u *Updater) Update(ctx context.Context) error {
+	now := time.Now()
+	guide := &Guide{
+		DisplayNames: make(map[string][]string),
+		Programmes:   make(map[string][]models.Programme),
+	}
+	for _, url := range u.URLs {
+		g, err := downloadGuide(ctx, url, now, now.Add(guideWindow))
+		if err != nil {
+			log.Printf("Failed to download EPG %s: %v", url, err)
+			continue
+		}
+		for id, names := range g.DisplayNames {
+			guide.DisplayNames[id] = append(guide.DisplayNames[id], names...)
+		}
+		for id, programmes := range g.Programmes {
+			guide.Programmes[id] = append(guide.Programmes[id], programmes...)
+		}
+	}
+	if len(guide.Programmes) == 0 {
+		return fmt.Errorf("no programmes found in any guide")
+	}
+
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Redis client: %w", err)
+	}
+	r.Prefix = "channel"
+
+	channels, err := r.ListChannels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list channels: %w", err)
+	}
+	matches := matchChannels(channels, guide)
+
+	// Only store the programmes of channels we actually have
+	stored := make(map[string]bool)
+	for _, xmltvID := range matches {
+		if stored[xmltvID] {
+			continue
+		}
+		stored[xmltvID] = true
+		if err := r.SaveProgrammes(ctx, xmltvID, guide.Programmes[xmltvID]); err != nil {
+			return err
+		}
+	}
+	if err := r.SaveEPGMatches(ctx, matches); err != nil {
+		return err
+	}
+
+	log.Printf("EPG updated: %d channels matched to %d guide channels", len(matches), len(stored))
+	return nil
+}
+
+func downloadGuide(ctx context.Context, url string, from, to time.Time) (*Guide, error) {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download guide: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download guide: unexpected status %s", resp.Status)
+	}
+
+	return parseXMLTV(resp.Body, from, to)
+}
+
+// matchChannels maps catalog channel IDs to XMLTV channel ids, by tvg-id
+// first and by fuzzy name otherwise. Only guide channels with programmes are
+// considered.
+func matchChannels(channels []*models.TvChannel, guide *Guide) map[string]string {
+	byID := make(map[string]string)
+	byName := make(map[string]string)
+	for id := range guide.Programmes {
+		byID[strings.ToLower(id)] = id
+		names := append([]string{id}, guide.DisplayNames[id]...)
+		for _, name := range names {
+			key := matchKey(name)
+			if _, ok := byName[key]; !ok && key != "" {
+				byName[key] = id
+			}
+		}
+	}
+
+	matches := make(map[string]string)
+	for _, c := range channels {
+		if c.TvgID != "" {
+			if id, ok := byID[strings.ToLower(c.TvgID)]; ok {
+				matches[c.ID] = id
+				continue
+			}
+		}
+		for _, name := range []string{c.TvgName, c.Name} {
+			if id, ok := byName[matchKey(name)]; ok && name != "" {
+				matches[c.ID] = id
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// matchKey folds a channel name for fuzzy matching: accents and case are
+// removed, punctuation is ignored and quality markers are dropped.
+func matchKey(name string) string {
+	var tokens []string
+	for _, token := range search.Tokens(qualityMarkers.ReplaceAllString(name, " ")) {
+		if !qualityTokens[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	return strings.Join(tokens, "")
+}
@@ -0,0 +1,138 @@
+package epg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Guide is the subset of an XMLTV document the bot needs.
+type Guide struct {
+	// DisplayNames of every XMLTV channel, keyed by channel id
+	DisplayNames map[string][]string
+	// Programmes of every XMLTV channel, keyed by channel id
+	Programmes map[string][]models.Programme
+}
+
+type xmltvChannel struct {
+	ID           string   `xml:"id,attr"`
+	DisplayNames []string `xml:"display-name"`
+}
+
+type xmltvProgramme struct {
+	Start    string `xml:"start,attr"`
+	Stop     string `xml:"stop,attr"`
+	Channel  string `xml:"channel,attr"`
+	Title    string `xml:"title"`
+	Desc     string `xml:"desc"`
+	Category string `xml:"category"`
+}
+
+// xmltvTimeLayouts are the accepted formats of programme start/stop times.
+// XMLTV allows truncated times, the offset is optional and defaults to UTC.
+var xmltvTimeLayouts = []string{
+	"20060102150405 -0700",
+	"20060102150405",
+	"200601021504 -0700",
+	"200601021504",
+}
+
+// parseXMLTV reads an XMLTV document, gzip compressed or not, keeping only
+// programmes that overlap the [from, to) window.
+func parseXMLTV(r io.Reader, from, to time.Time) (*Guide, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	guide := &Guide{
+		DisplayNames: make(map[string][]string),
+		Programmes:   make(map[string][]models.Programme),
+	}
+
+	decoder := xml.NewDecoder(r)
+	// Guides are often declared as ISO-8859-1 or windows-1252, accented
+	// titles would not decode as UTF-8
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported xmltv charset %q", charset)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xmltv: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "channel":
+			var c xmltvChannel
+			if err := decoder.DecodeElement(&c, &start); err != nil {
+				return nil, fmt.Errorf("failed to parse xmltv channel: %w", err)
+			}
+			guide.DisplayNames[c.ID] = append(guide.DisplayNames[c.ID], c.DisplayNames...)
+		case "programme":
+			var p xmltvProgramme
+			if err := decoder.DecodeElement(&p, &start); err != nil {
+				return nil, fmt.Errorf("failed to parse xmltv programme: %w", err)
+			}
+			startTime, err := parseXMLTVTime(p.Start)
+			if err != nil {
+				continue
+			}
+			stopTime, err := parseXMLTVTime(p.Stop)
+			if err != nil {
+				// Without a stop time the programme runs until the next one,
+				// assume a sensible default instead
+				stopTime = startTime.Add(time.Hour)
+			}
+			if !stopTime.After(from) || !startTime.Before(to) {
+				continue
+			}
+			guide.Programmes[p.Channel] = append(guide.Programmes[p.Channel], models.Programme{
+				Channel:  p.Channel,
+				Title:    strings.TrimSpace(p.Title),
+				Desc:     strings.TrimSpace(p.Desc),
+				Category: strings.TrimSpace(p.Category),
+				Start:    startTime,
+				Stop:     stopTime,
+			})
+		}
+	}
+
+	return guide, nil
+}
+
+func parseXMLTVTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range xmltvTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid xmltv time: %q", value)
+}
@@ -0,0 +1,299 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const (
+	defaultInterval     = time.Hour
+	defaultConcurrency  = 8
+	defaultHostInterval = time.Second
+	defaultTimeout      = 10 * time.Second
+
+	// Manifests are small, anything bigger is not a playlist
+	maxManifestSize = 256 * 1024
+	// Master playlists may point to other master playlists, but not forever
+	maxManifestDepth = 3
+)
+
+// Prober periodically checks every channel URL and stores its health.
+// At most Concurrency checks run at once and requests to the same host are
+// spaced by at least HostInterval, IPTV providers ban clients that hammer them.
+type Prober struct {
+	Interval     time.Duration
+	Concurrency  int
+	HostInterval time.Duration
+	Timeout      time.Duration
+
+	client *http.Client
+	hosts  *hostLimiter
+}
+
+// NewProber creates a Prober from the environment:
+// HEALTH_CHECK_INTERVAL (Go duration, "0" disables the prober),
+// HEALTH_CHECK_CONCURRENCY, HEALTH_CHECK_HOST_INTERVAL and HEALTH_CHECK_TIMEOUT.
+func NewProber() (*Prober, error) {
+	p := &Prober{
+		Interval:     defaultInterval,
+		Concurrency:  defaultConcurrency,
+		HostInterval: defaultHostInterval,
+		Timeout:      defaultTimeout,
+	}
+
+	durations := map[string]*time.Duration{
+		"HEALTH_CHECK_INTERVAL":      &p.Interval,
+		"HEALTH_CHECK_HOST_INTERVAL": &p.HostInterval,
+		"HEALTH_CHECK_TIMEOUT":       &p.Timeout,
+	}
+	for env, target := range durations {
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			*target = parsed
+		}
+	}
+	if v, ok := os.LookupEnv("HEALTH_CHECK_CONCURRENCY"); ok && v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("invalid HEALTH_CHECK_CONCURRENCY: %q", v)
+		}
+		p.Concurrency = parsed
+	}
+
+	p.client = &http.Client{Timeout: p.Timeout}
+	p.hosts = &hostLimiter{interval: p.HostInterval, next: make(map[string]time.Time)}
+	return p, nil
+}
+
+// Run checks every channel right away and then every Interval until the
+// context is cancelled.
+func (p *Prober) Run(ctx context.Context) {
+	if p.Interval <= 0 {
+		log.Println("Channel health prober disabled")
+		return
+	}
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.CheckAll(ctx); err != nil {
+			log.Printf("Channel health check failed: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CheckAll checks every channel of the active catalog.
+func (p *Prober) CheckAll(ctx context.Context) error {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Redis client: %w", err)
+	}
+	r.Prefix = "channel"
+
+	channels, err := r.ListChannels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list channels: %w", err)
+	}
+	log.Printf("Checking health of %d channels", len(channels))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	alive, dead := 0, 0
+	sem := make(chan struct{}, p.Concurrency)
+	for _, channel := range channels {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(channel *models.TvChannel) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			health := p.Check(ctx, channel.URL)
+			if err := r.SaveChannelHealth(ctx, channel.ID, health); err != nil {
+				log.Printf("Error saving channel health: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if health.Status == models.HealthAlive {
+				alive++
+			} else {
+				dead++
+			}
+		}(channel)
+	}
+	wg.Wait()
+
+	log.Printf("Channel health check finished: %d alive, %d dead", alive, dead)
+	return nil
+}
+
+// Check probes a stream URL. HLS streams must serve a manifest and its first
+// segment, other streams must answer with a media content type.
+func (p *Prober) Check(ctx context.Context, streamURL string) models.ChannelHealth {
+	health := models.ChannelHealth{
+		Status:    models.HealthDead,
+		URL:       streamURL,
+		CheckedAt: time.Now(),
+	}
+
+	start := time.Now()
+	resp, err := p.get(ctx, streamURL, false)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer resp.Body.Close()
+	health.Latency = time.Since(start)
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	body := bufio.NewReader(io.LimitReader(resp.Body, maxManifestSize))
+	if isHLS(resp.Request.URL, contentType, body) {
+		err = p.checkManifest(ctx, resp.Request.URL, body, 0)
+	} else if !isMediaType(contentType) {
+		err = fmt.Errorf("unexpected content type %q", contentType)
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	health.Status = models.HealthAlive
+	return health
+}
+
+// checkManifest follows an HLS playlist down to its first media segment.
+func (p *Prober) checkManifest(ctx context.Context, base *url.URL, body io.Reader, depth int) error {
+	if depth >= maxManifestDepth {
+		return fmt.Errorf("too many nested playlists")
+	}
+
+	master := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			master = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ref, err := base.Parse(line)
+		if err != nil {
+			return fmt.Errorf("invalid playlist entry %q: %w", line, err)
+		}
+
+		resp, err := p.get(ctx, ref.String(), !master)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if master {
+			// Variant playlist, check its first segment
+			return p.checkManifest(ctx, resp.Request.URL, io.LimitReader(resp.Body, maxManifestSize), depth+1)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return fmt.Errorf("playlist has no segments")
+}
+
+// get sends a rate limited GET request and fails on non 2xx answers.
+// Segments are requested with a small range, the status is all we need.
+func (p *Prober) get(ctx context.Context, rawURL string, segment bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if segment {
+		req.Header.Set("Range", "bytes=0-1023")
+	}
+
+	if err := p.hosts.wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func isHLS(u *url.URL, contentType string, body *bufio.Reader) bool {
+	if strings.Contains(contentType, "mpegurl") || strings.HasSuffix(strings.ToLower(u.Path), ".m3u8") {
+		return true
+	}
+	head, _ := body.Peek(len("#EXTM3U"))
+	return string(head) == "#EXTM3U"
+}
+
+func isMediaType(contentType string) bool {
+	for _, prefix := range []string{"video/", "audio/", "application/octet-stream", "binary/octet-stream"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	// Some servers don't bother sending one
+	return contentType == ""
+}
+
+// hostLimiter spaces requests to the same host by at least interval.
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(slot)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
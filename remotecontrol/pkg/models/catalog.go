@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The channel catalog is imported into a versioned keyspace ("channel:v42:*")
+// and an active-version pointer ("channel:active") selects which version the
+// readers see. Flipping the pointer is a single SET, so readers never see a
+// half imported catalog. State keys such as "channel:current" are not part of
+// the catalog and stay unversioned.
+
+// legacyCatalogPatterns match the catalog keys written before versioning.
+var legacyCatalogPatterns = []string{"[0-9]*", "id:*", "name:*", "url:*", "counter", "ids"}
+
+// catalogPrefix returns the key prefix of the catalog this store reads from.
+// A store returned by BeginImport is pinned to its import version, any other
+// store resolves the active version through the pointer on every call.
+func (r *RedisStore) catalogPrefix(ctx context.Context) (string, error) {
+	if r.version > 0 {
+		return versionPrefix(r.Prefix, r.version), nil
+	}
+
+	active, err := r.Client.Get(ctx, fmt.Sprintf("%s:active", r.Prefix)).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return r.Prefix, nil // Catalog imported before versioning
+		}
+		return "", fmt.Errorf("failed to get active catalog version: %w", err)
+	}
+	return versionPrefix(r.Prefix, active), nil
+}
+
+func versionPrefix(prefix string, version int64) string {
+	return fmt.Sprintf("%s:v%d", prefix, version)
+}
+
+// BeginImport allocates a new catalog version and returns a store pinned to
+// it. Channels saved through the returned store are invisible to readers
+// until CommitImport is called.
+func (r *RedisStore) BeginImport(ctx context.Context) (*RedisStore, error) {
+	version, err := r.Client.Incr(ctx, fmt.Sprintf("%s:version", r.Prefix)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate catalog version: %w", err)
+	}
+
+	// Track the version right away so a crashed import gets garbage-collected
+	if err := r.Client.SAdd(ctx, fmt.Sprintf("%s:versions", r.Prefix), version).Err(); err != nil {
+		return nil, fmt.Errorf("failed to register catalog version: %w", err)
+	}
+
+	log.Printf("Importing channel catalog version %d", version)
+	return &RedisStore{Client: r.Client, Prefix: r.Prefix, version: version}, nil
+}
+
+// CommitImport atomically makes the pinned version the active catalog and
+// garbage-collects old versions. The previously active version is kept so
+// reads that resolved it just before the flip can still finish.
+func (r *RedisStore) CommitImport(ctx context.Context) error {
+	if r.version == 0 {
+		return fmt.Errorf("store is not pinned to an import version")
+	}
+
+	activeKey := fmt.Sprintf("%s:active", r.Prefix)
+	previous, err := r.Client.GetSet(ctx, activeKey, r.version).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to activate catalog version %d: %w", r.version, err)
+	}
+	log.Printf("Channel catalog version %d is now active", r.version)
+
+	keep := map[string]bool{strconv.FormatInt(r.version, 10): true, previous: true}
+	if err := r.collectVersions(ctx, keep); err != nil {
+		log.Printf("Failed to garbage-collect catalog versions: %v", err)
+	}
+	if previous == "" {
+		// First versioned import, drop the unversioned catalog
+		for _, pattern := range legacyCatalogPatterns {
+			if err := r.deleteKeys(ctx, fmt.Sprintf("%s:%s", r.Prefix, pattern)); err != nil {
+				log.Printf("Failed to delete legacy catalog keys: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AbortImport deletes the partially imported version.
+func (r *RedisStore) AbortImport(ctx context.Context) error {
+	if r.version == 0 {
+		return fmt.Errorf("store is not pinned to an import version")
+	}
+	if err := r.deleteKeys(ctx, versionPrefix(r.Prefix, r.version)+":*"); err != nil {
+		return err
+	}
+	return r.Client.SRem(ctx, fmt.Sprintf("%s:versions", r.Prefix), r.version).Err()
+}
+
+// collectVersions deletes every catalog version that is not in keep.
+func (r *RedisStore) collectVersions(ctx context.Context, keep map[string]bool) error {
+	versionsKey := fmt.Sprintf("%s:versions", r.Prefix)
+	versions, err := r.Client.SMembers(ctx, versionsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list catalog versions: %w", err)
+	}
+
+	for _, v := range versions {
+		if keep[v] {
+			continue
+		}
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := r.deleteKeys(ctx, versionPrefix(r.Prefix, version)+":*"); err != nil {
+			return err
+		}
+		if err := r.Client.SRem(ctx, versionsKey, v).Err(); err != nil {
+			return err
+		}
+		log.Printf("Deleted channel catalog version %d", version)
+	}
+	return nil
+}
+
+// deleteKeys removes every key matching pattern.
+func (r *RedisStore) deleteKeys(ctx context.Context, pattern string) error {
+	iter := r.Client.Scan(ctx, 0, pattern, 0).Iterator()
+
+	for iter.Next(ctx) {
+		if err := r.Client.Del(ctx, iter.Val()).Err(); err != nil {
+			return fmt.Errorf("failed to delete key %s: %w", iter.Val(), err)
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// What the streamer should be doing is kept in desiredStateKey. Commands only
+// change this record, the reconciler sends the stream commands until the
+// streamer reports the same state. The record is shaped like a command so
+// the streamer can replay it when it boots. Every change bumps the generation
+// and is announced on desiredUpdatesChannel to wake the reconciler up.
+const (
+	desiredGenerationKey  = "tvbarrapesada:desired:generation"
+	desiredUpdatesChannel = "tvbarrapesada:desired:updates"
+	// Times updateDesired reads the state again when it changed meanwhile
+	desiredUpdateAttempts = 3
+)
+
+// ErrDesiredChanged is returned by changes based on a desired state that was
+// replaced meanwhile.
+var ErrDesiredChanged = errors.New("desired state changed meanwhile")
+
+// StreamOptions override the streamer defaults for one stream, zero values
+// keep the defaults.
+type StreamOptions struct {
+	Width       int `json:"width,omitempty"`
+	Height      int `json:"height,omitempty"`
+	FPS         int `json:"fps,omitempty"`
+	BitrateKbps int `json:"bitrate_kbps,omitempty"`
+}
+
+type DesiredState struct {
+	// "play" or "stop"
+	Command string `json:"command"`
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// Correlation ID of the command that asked for this state
+	ID string `json:"id,omitempty"`
+	// Empty for media that is not in the catalog
+	ChannelID string `json:"channel_id,omitempty"`
+	// Set by Failover: the channel asked for and the ones that failed since
+	Origin string   `json:"origin,omitempty"`
+	Tried  []string `json:"tried,omitempty"`
+	// Finite media ends on its own and must not be played again when it does,
+	// the reconciler then stops it with FinishDesired
+	Finite     bool           `json:"finite,omitempty"`
+	Options    *StreamOptions `json:"options,omitempty"`
+	Generation int64          `json:"generation"`
+	// Set by Restart, the reconciler restarts the streamer and clears it
+	Dirty     bool      `json:"dirty,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Playing reports whether something should be on.
+func (d *DesiredState) Playing() bool {
+	return d.Command == "play"
+}
+
+// setDesired replaces the desired state with a new generation. The correlation
+// ID comes from the context, see WithCommandID.
+func (r *RedisStore) setDesired(ctx context.Context, state DesiredState) error {
+	if err := nextGeneration(ctx, r.Client, &state); err != nil {
+		return err
+	}
+	return r.saveDesired(ctx, &state)
+}
+
+// nextGeneration gives a desired state a new generation and the correlation
+// ID of the context.
+func nextGeneration(ctx context.Context, client redis.Cmdable, state *DesiredState) error {
+	generation, err := client.Incr(ctx, desiredGenerationKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to allocate desired state generation: %w", err)
+	}
+	state.Generation = generation
+	state.ID = commandIDFromContext(ctx)
+	if state.ID == "" {
+		state.ID = NewSessionID()
+	}
+	return nil
+}
+
+func (r *RedisStore) saveDesired(ctx context.Context, state *DesiredState) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return queueDesired(ctx, pipe, state)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save desired state: %w", err)
+	}
+	return nil
+}
+
+// queueDesired adds the writes of a desired state change to a transaction.
+func queueDesired(ctx context.Context, pipe redis.Pipeliner, state *DesiredState) error {
+	state.UpdatedAt = time.Now()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal desired state: %w", err)
+	}
+
+	log.Printf("Desired state: %s", data)
+	pipe.Set(ctx, desiredStateKey, data, 0)
+	pipe.Publish(ctx, desiredUpdatesChannel, state.Generation)
+	return nil
+}
+
+// updateDesired changes the current desired state in place. The read and the
+// write are one transaction, a change landing in between is never written
+// over, update runs again on it instead. update returns false to leave the
+// state as it is. With bump the change gets a new generation like setDesired.
+func (r *RedisStore) updateDesired(ctx context.Context, bump bool, update func(state *DesiredState) bool) error {
+	for attempt := 0; attempt < desiredUpdateAttempts; attempt++ {
+		err := r.Client.Watch(ctx, func(tx *redis.Tx) error {
+			state, err := decodeDesired(tx.Get(ctx, desiredStateKey).Bytes())
+			if err != nil {
+				return err
+			}
+			if !update(state) {
+				return nil
+			}
+			if bump {
+				if err := nextGeneration(ctx, tx, state); err != nil {
+					return err
+				}
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				return queueDesired(ctx, pipe, state)
+			})
+			return err
+		}, desiredStateKey)
+		if err != redis.TxFailedErr {
+			if err != nil {
+				return fmt.Errorf("failed to update desired state: %w", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update desired state: it kept changing")
+}
+
+// GetDesired returns what the streamer should be doing, stopped when nothing
+// was ever requested.
+func (r *RedisStore) GetDesired(ctx context.Context) (*DesiredState, error) {
+	return decodeDesired(r.Client.Get(ctx, desiredStateKey).Bytes())
+}
+
+func decodeDesired(data []byte, err error) (*DesiredState, error) {
+	if err == redis.Nil {
+		return &DesiredState{Command: "stop"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired state: %w", err)
+	}
+
+	var state DesiredState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal desired state: %w", err)
+	}
+	return &state, nil
+}
+
+// ClearDesiredDirty clears the dirty flag of the given generation, unless the
+// desired state changed meanwhile.
+func (r *RedisStore) ClearDesiredDirty(ctx context.Context, generation int64) error {
+	return r.updateDesired(ctx, false, func(state *DesiredState) bool {
+		if state.Generation != generation || !state.Dirty {
+			return false
+		}
+		state.Dirty = false
+		return true
+	})
+}
+
+// FinishDesired stops the desired state of the given generation once its
+// finite media ended, so the streamer does not play it again from the start
+// when it boots. A desired state that changed meanwhile is left alone.
+func (r *RedisStore) FinishDesired(ctx context.Context, generation int64) error {
+	return r.updateDesired(ctx, true, func(state *DesiredState) bool {
+		if state.Generation != generation || !state.Playing() || !state.Finite {
+			return false
+		}
+		*state = DesiredState{Command: "stop"}
+		return true
+	})
+}
+
+// SubscribeDesired subscribes to desired state changes, the caller must close
+// the returned PubSub.
+func (r *RedisStore) SubscribeDesired(ctx context.Context) *redis.PubSub {
+	return r.Client.Subscribe(ctx, desiredUpdatesChannel)
+}
+
+// SendCommand sends a command to the streamer. Only the reconciler should
+// call it, everything else changes the desired state.
+func (r *RedisStore) SendCommand(ctx context.Context, command ChannelCommand) error {
+	return r.publishCommand(ctx, command)
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// While the DJ lock of a guild is held only its holder, or a moderator of the
+// guild, may change the channel from that guild. Guilds configure the lock
+// separately, so each has its own "dj:lock:<guild id>" key. It expires on its
+// own with the key.
+const djLockPrefix = "dj:lock"
+
+func djLockKey(guildID string) string {
+	return fmt.Sprintf("%s:%s", djLockPrefix, guildID)
+}
+
+type DJLock struct {
+	UserID   string    `json:"user_id"`
+	UserName string    `json:"user_name"`
+	GuildID  string    `json:"guild_id,omitempty"`
+	Until    time.Time `json:"until"`
+}
+
+// SetDJLock gives the DJ lock of lock.GuildID to someone until lock.Until.
+func (r *RedisStore) SetDJLock(ctx context.Context, lock DJLock) error {
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dj lock: %w", err)
+	}
+	if err := r.Client.Set(ctx, djLockKey(lock.GuildID), data, time.Until(lock.Until)).Err(); err != nil {
+		return fmt.Errorf("failed to set dj lock: %w", err)
+	}
+	return nil
+}
+
+// GetDJLock returns the DJ lock of a guild, or nil when nobody holds it.
+func (r *RedisStore) GetDJLock(ctx context.Context, guildID string) (*DJLock, error) {
+	data, err := r.Client.Get(ctx, djLockKey(guildID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dj lock: %w", err)
+	}
+
+	var lock DJLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dj lock: %w", err)
+	}
+	return &lock, nil
+}
+
+// ClearDJLock releases the DJ lock of a guild.
+func (r *RedisStore) ClearDJLock(ctx context.Context, guildID string) error {
+	if err := r.Client.Del(ctx, djLockKey(guildID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear dj lock: %w", err)
+	}
+	return nil
+}
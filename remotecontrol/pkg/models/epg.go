@@ -0,0 +1,271 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EPG data is stored per XMLTV channel in a sorted set of programmes scored by
+// start time ("epg:prog:<xmltv id>"), expiring when its last programme ends.
+// "epg:match" maps catalog channel IDs to the XMLTV channel they were matched to.
+const (
+	epgProgrammesKey = "epg:prog"
+	epgMatchKey      = "epg:match"
+)
+
+type Programme struct {
+	Channel  string    `json:"channel"`
+	Title    string    `json:"title"`
+	Desc     string    `json:"desc,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Start    time.Time `json:"start"`
+	Stop     time.Time `json:"stop"`
+}
+
+// ChannelProgramme is a programme airing on a catalog channel.
+type ChannelProgramme struct {
+	ChannelID string
+	Programme Programme
+}
+
+// SaveProgrammes replaces the programmes of an XMLTV channel.
+func (r *RedisStore) SaveProgrammes(ctx context.Context, xmltvID string, programmes []Programme) error {
+	key := fmt.Sprintf("%s:%s", epgProgrammesKey, xmltvID)
+	if len(programmes) == 0 {
+		return r.Client.Del(ctx, key).Err()
+	}
+
+	members := make([]*redis.Z, 0, len(programmes))
+	var lastStop time.Time
+	for _, p := range programmes {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("failed to marshal programme: %w", err)
+		}
+		members = append(members, &redis.Z{Score: float64(p.Start.Unix()), Member: data})
+		if p.Stop.After(lastStop) {
+			lastStop = p.Stop
+		}
+	}
+
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.ExpireAt(ctx, key, lastStop)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save programmes for %s: %w", xmltvID, err)
+	}
+	return nil
+}
+
+// SaveEPGMatches replaces the channel ID to XMLTV channel mapping.
+func (r *RedisStore) SaveEPGMatches(ctx context.Context, matches map[string]string) error {
+	fields := make(map[string]interface{}, len(matches))
+	for channelID, xmltvID := range matches {
+		fields[channelID] = xmltvID
+	}
+
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, epgMatchKey)
+		if len(fields) > 0 {
+			pipe.HSet(ctx, epgMatchKey, fields)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save epg matches: %w", err)
+	}
+	return nil
+}
+
+// GetProgrammes returns up to limit programmes of a catalog channel, starting
+// with the one airing at the given time. It returns no programmes and no
+// error when the channel has no EPG data.
+func (r *RedisStore) GetProgrammes(ctx context.Context, channelID string, at time.Time, limit int64) ([]Programme, error) {
+	xmltvID, err := r.Client.HGet(ctx, epgMatchKey, channelID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get epg match: %w", err)
+	}
+	key := fmt.Sprintf("%s:%s", epgProgrammesKey, xmltvID)
+
+	// The programme airing now is the last one that started before at
+	current, err := r.Client.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(at.Unix(), 10),
+		Count: 1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get programmes: %w", err)
+	}
+	upcoming, err := r.Client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "(" + strconv.FormatInt(at.Unix(), 10),
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get programmes: %w", err)
+	}
+
+	var programmes []Programme
+	for _, data := range append(current, upcoming...) {
+		var p Programme
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			continue
+		}
+		if !p.Stop.After(at) {
+			continue // Gap in the guide, nothing airing right now
+		}
+		programmes = append(programmes, p)
+	}
+	if int64(len(programmes)) > limit {
+		programmes = programmes[:limit]
+	}
+	return programmes, nil
+}
+
+// GetNowNext returns the programme airing now and the one after it on a
+// catalog channel. Either may be nil when the guide has no data.
+func (r *RedisStore) GetNowNext(ctx context.Context, channelID string) (*Programme, *Programme, error) {
+	now := time.Now()
+	programmes, err := r.GetProgrammes(ctx, channelID, now, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current, next *Programme
+	for i := range programmes {
+		p := &programmes[i]
+		if !p.Start.After(now) && current == nil {
+			current = p
+		} else if next == nil {
+			next = p
+		}
+	}
+	return current, next, nil
+}
+
+// SearchProgrammesNow returns the programmes airing now whose title contains
+// the query, ignoring case.
+func (r *RedisStore) SearchProgrammesNow(ctx context.Context, query string) ([]ChannelProgramme, error) {
+	matches, err := r.Client.HGetAll(ctx, epgMatchKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get epg matches: %w", err)
+	}
+
+	now := time.Now()
+	nowScore := strconv.FormatInt(now.Unix(), 10)
+	channelIDs := make([]string, 0, len(matches))
+	cmds := make([]*redis.StringSliceCmd, 0, len(matches))
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for channelID, xmltvID := range matches {
+			channelIDs = append(channelIDs, channelID)
+			cmds = append(cmds, pipe.ZRevRangeByScore(ctx, fmt.Sprintf("%s:%s", epgProgrammesKey, xmltvID), &redis.ZRangeBy{
+				Min:   "-inf",
+				Max:   nowScore,
+				Count: 1,
+			}))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get programmes: %w", err)
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var results []ChannelProgramme
+	for i, cmd := range cmds {
+		for _, data := range cmd.Val() {
+			var p Programme
+			if err := json.Unmarshal([]byte(data), &p); err != nil {
+				continue
+			}
+			if !p.Stop.After(now) || !strings.Contains(strings.ToLower(p.Title), query) {
+				continue
+			}
+			results = append(results, ChannelProgramme{ChannelID: channelIDs[i], Programme: p})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, _ := strconv.Atoi(results[i].ChannelID)
+		b, _ := strconv.Atoi(results[j].ChannelID)
+		return a < b
+	})
+	return results, nil
+}
+
+// SearchUpcomingProgrammes returns the programmes starting between from and
+// until whose title contains the query, ignoring case, soonest first. With a
+// channel ID only that channel is searched.
+func (r *RedisStore) SearchUpcomingProgrammes(ctx context.Context, query, channelID string, from, until time.Time) ([]ChannelProgramme, error) {
+	matches := make(map[string]string)
+	if channelID != "" {
+		xmltvID, err := r.Client.HGet(ctx, epgMatchKey, channelID).Result()
+		if err == redis.Nil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get epg match: %w", err)
+		}
+		matches[channelID] = xmltvID
+	} else {
+		all, err := r.Client.HGetAll(ctx, epgMatchKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get epg matches: %w", err)
+		}
+		matches = all
+	}
+
+	channelIDs := make([]string, 0, len(matches))
+	cmds := make([]*redis.StringSliceCmd, 0, len(matches))
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for channelID, xmltvID := range matches {
+			channelIDs = append(channelIDs, channelID)
+			cmds = append(cmds, pipe.ZRangeByScore(ctx, fmt.Sprintf("%s:%s", epgProgrammesKey, xmltvID), &redis.ZRangeBy{
+				Min: strconv.FormatInt(from.Unix(), 10),
+				Max: strconv.FormatInt(until.Unix(), 10),
+			}))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get programmes: %w", err)
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var results []ChannelProgramme
+	for i, cmd := range cmds {
+		for _, data := range cmd.Val() {
+			var p Programme
+			if err := json.Unmarshal([]byte(data), &p); err != nil {
+				continue
+			}
+			if !strings.Contains(strings.ToLower(p.Title), query) {
+				continue
+			}
+			results = append(results, ChannelProgramme{ChannelID: channelIDs[i], Programme: p})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].Programme.Start.Equal(results[j].Programme.Start) {
+			return results[i].Programme.Start.Before(results[j].Programme.Start)
+		}
+		a, _ := strconv.Atoi(results[i].ChannelID)
+		b, _ := strconv.Atoi(results[j].ChannelID)
+		return a < b
+	})
+	return results, nil
+}
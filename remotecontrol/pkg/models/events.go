@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The streamer reports what happens to the commands it receives on the
+// streamerEventsChannel pub/sub channel. Events about a command carry the
+// correlation ID the command was published with.
+const streamerEventsChannel = "tvbarrapesada:events"
+
+const (
+	// The streamer received a command
+	EventAck = "ack"
+	// Looking up the media and joining the voice channel
+	EventBuffering = "buffering"
+	// The stream is up
+	EventStarted = "started"
+	// The stream reached its end, finite media only
+	EventEnded = "ended"
+	// The stream could not start or broke
+	EventError = "error"
+	// Sent periodically, and right after the streamer boots
+	EventHeartbeat = "heartbeat"
+)
+
+// ErrStreamerTimeout is returned when the streamer does not report back in time.
+var ErrStreamerTimeout = errors.New("streamer did not answer in time")
+
+type StreamerEvent struct {
+	Event   string `json:"event"`
+	ID      string `json:"id,omitempty"`
+	Command string `json:"command,omitempty"`
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Heartbeats only
+	State string    `json:"state,omitempty"`
+	Boot  bool      `json:"boot,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+type commandIDKey struct{}
+
+// WithCommandID returns a context whose commands are published with the given
+// correlation ID, so the events about them can be told apart.
+func WithCommandID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, commandIDKey{}, id)
+}
+
+func commandIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(commandIDKey{}).(string)
+	return id
+}
+
+// SubscribeEvents subscribes to the streamer events, the caller must close
+// the returned PubSub.
+func (r *RedisStore) SubscribeEvents(ctx context.Context) *redis.PubSub {
+	return r.Client.Subscribe(ctx, streamerEventsChannel)
+}
+
+// ParseEvent decodes a message received from the streamer events channel.
+func ParseEvent(msg *redis.Message) (*StreamerEvent, error) {
+	var event StreamerEvent
+	if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal streamer event: %w", err)
+	}
+	return &event, nil
+}
+
+// EventWatcher receives the streamer events from the moment it is created, so
+// it must be created before publishing the command to wait for.
+type EventWatcher struct {
+	pubsub *redis.PubSub
+	events <-chan *redis.Message
+}
+
+// WatchEvents subscribes to the streamer events and waits for the subscription
+// to be active.
+func (r *RedisStore) WatchEvents(ctx context.Context) (*EventWatcher, error) {
+	pubsub := r.SubscribeEvents(ctx)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to streamer events: %w", err)
+	}
+	return &EventWatcher{pubsub: pubsub, events: pubsub.Channel()}, nil
+}
+
+func (w *EventWatcher) Close() error {
+	return w.pubsub.Close()
+}
+
+// WaitFor returns the first event accepted by match. It returns
+// ErrStreamerTimeout when the context is done first.
+func (w *EventWatcher) WaitFor(ctx context.Context, match func(*StreamerEvent) bool) (*StreamerEvent, error) {
+	for {
+		select {
+		case msg, ok := <-w.events:
+			if !ok {
+				return nil, fmt.Errorf("streamer events subscription closed")
+			}
+			event, err := ParseEvent(msg)
+			if err != nil {
+				continue
+			}
+			if match(event) {
+				return event, nil
+			}
+		case <-ctx.Done():
+			return nil, ErrStreamerTimeout
+		}
+	}
+}
+
+// WaitOutcome waits up to timeout for the outcome of the command with the
+// given correlation ID: started, ended or error. acked reports whether the
+// streamer received the command at all, which tells a slow start from a
+// streamer that is down.
+func (w *EventWatcher) WaitOutcome(ctx context.Context, id string, timeout time.Duration) (event *StreamerEvent, acked bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	event, err = w.WaitFor(ctx, func(e *StreamerEvent) bool {
+		if e.ID != id {
+			return false
+		}
+		switch {
+		case e.Event == EventAck || e.Event == EventBuffering:
+			acked = true
+			return false
+		case e.Command == "stop":
+			// The reconciler sends a stop first with the same ID
+			return false
+		}
+		return e.Event == EventStarted || e.Event == EventEnded || e.Event == EventError
+	})
+	return event, acked, err
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Playlists often list the same channel several times, in HD and SD or from
+// a backup source. Save groups them in two catalog sets, "alt:name:<logical
+// name>" and "alt:tvg:<tvg-id>", and any channel sharing a set with another
+// is an alternate of it.
+
+// qualityTokens are the words dropped from a channel name to get its logical
+// name.
+var qualityTokens = map[string]bool{
+	"SD": true, "HD": true, "FHD": true, "UHD": true, "4K": true, "8K": true,
+	"480P": true, "720P": true, "1080P": true, "2160P": true,
+	"H264": true, "H265": true, "HEVC": true, "50FPS": true, "60FPS": true,
+	"ALT": true, "ALTERNATIVO": true, "BACKUP": true, "BKP": true,
+}
+
+// LogicalName returns the normalized name of a channel without its quality
+// and backup markers, "ESPN HD" and "ESPN [SD]" are both "ESPN".
+func LogicalName(name string) string {
+	words := strings.Fields(NormalizeName(name))
+	kept := words[:0]
+	for _, word := range words {
+		if !qualityTokens[word] {
+			kept = append(kept, word)
+		}
+	}
+	if len(kept) == 0 {
+		return NormalizeName(name)
+	}
+	return strings.Join(kept, " ")
+}
+
+func alternateKeys(prefix string, c TvChannel) []string {
+	keys := []string{fmt.Sprintf("%s:alt:name:%s", prefix, LogicalName(c.Name))}
+	if c.TvgID != "" {
+		keys = append(keys, fmt.Sprintf("%s:alt:tvg:%s", prefix, strings.ToLower(c.TvgID)))
+	}
+	return keys
+}
+
+type Alternate struct {
+	Channel *TvChannel
+	Health  *ChannelHealth
+}
+
+// GetAlternates returns the other catalog entries of the same logical
+// channel, best health score first.
+func (r *RedisStore) GetAlternates(ctx context.Context, channel *TvChannel) ([]Alternate, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := r.Client.SUnion(ctx, alternateKeys(prefix, *channel)...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alternates of channel %s: %w", channel.ID, err)
+	}
+
+	alternates := make([]Alternate, 0, len(ids))
+	for _, id := range ids {
+		if id == channel.ID {
+			continue
+		}
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		alternate, err := r.GetChannelByID(ctx, n)
+		if err != nil {
+			log.Printf("Error getting alternate channel %s: %v", id, err)
+			continue
+		}
+		health, err := r.GetChannelHealth(ctx, alternate)
+		if err != nil {
+			log.Printf("Error getting health of alternate channel %s: %v", id, err)
+			health = &ChannelHealth{Status: HealthUnknown, URL: alternate.URL}
+		}
+		alternates = append(alternates, Alternate{Channel: alternate, Health: health})
+	}
+
+	sort.SliceStable(alternates, func(i, j int) bool {
+		si, sj := alternates[i].Health.Score(), alternates[j].Health.Score()
+		if si != sj {
+			return si > sj
+		}
+		return alternates[i].Channel.ID < alternates[j].Channel.ID
+	})
+	return alternates, nil
+}
+
+// Failover replaces a desired channel that keeps failing with one of its
+// alternates, which becomes the current channel like with Play. The new
+// desired state keeps the correlation ID and remembers every channel tried
+// since the one that was asked for. It returns ErrDesiredChanged when the
+// desired state is not from anymore.
+func (r *RedisStore) Failover(ctx context.Context, from *DesiredState, to *TvChannel) error {
+	origin := from.Origin
+	if origin == "" {
+		origin = from.ChannelID
+	}
+	tried := append(append([]string{}, from.Tried...), from.ChannelID)
+
+	changed := false
+	err := r.updateDesired(WithCommandID(ctx, from.ID), true, func(state *DesiredState) bool {
+		if state.Generation != from.Generation {
+			changed = true
+			return false
+		}
+		*state = DesiredState{
+			Command:   "play",
+			Title:     to.Name,
+			URL:       to.URL,
+			ChannelID: to.ID,
+			Origin:    origin,
+			Tried:     tried,
+			Options:   from.Options,
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if changed {
+		return ErrDesiredChanged
+	}
+
+	// The alternate stands in for the failing channel, whoever asked for it
+	// keeps the history entry and /back does not lead to it
+	ctx = WithRequester(ctx, r.openRequester(ctx))
+	r.recordPlay(WithHistoryNote(ctx, fmt.Sprintf("instead of %s, it kept failing", from.Title)), to.ID, to.URL, to.Name)
+	if err := r.replaceCurrentChannel(ctx, to); err != nil {
+		return fmt.Errorf("failed to register current channel: %w", err)
+	}
+	return r.setPlayback(ctx, PlaybackState{Playing: true, ChannelID: to.ID, Title: to.Name})
+}
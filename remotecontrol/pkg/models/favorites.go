@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Favorites are sets of channel references under "fav:user:<user id>" and
+// "fav:guild:<guild id>". A reference is "<tvg id>|<url>" and not a channel
+// ID, so favorites outlive the catalog they were added from: they are
+// resolved against the active catalog every time they are read, by URL first
+// and by tvg-id when the URL changed. The last known name of every reference
+// is kept in "fav:names" to list favorites missing from the catalog.
+const (
+	favoritesPrefix   = "fav"
+	favoritesNamesKey = "fav:names"
+)
+
+const (
+	FavoritesUser  = "user"
+	FavoritesGuild = "guild"
+)
+
+type Favorite struct {
+	// Short hash of the reference, fits in component custom IDs
+	Key  string
+	Ref  string
+	Name string
+	// Nil when the channel is not in the active catalog
+	Channel *TvChannel
+}
+
+// FavoriteRef returns the reference a channel is stored as in favorites.
+func FavoriteRef(c *TvChannel) string {
+	return strings.ToLower(c.TvgID) + "|" + c.URL
+}
+
+func favoriteKey(ref string) string {
+	sum := sha1.Sum([]byte(ref))
+	return hex.EncodeToString(sum[:6])
+}
+
+func favoritesKey(scope, ownerID string) string {
+	return fmt.Sprintf("%s:%s:%s", favoritesPrefix, scope, ownerID)
+}
+
+// AddFavorite adds a channel to the favorites of a user or guild. It returns
+// false when the channel already was a favorite.
+func (r *RedisStore) AddFavorite(ctx context.Context, scope, ownerID string, c *TvChannel) (bool, error) {
+	favorites, err := r.GetFavorites(ctx, scope, ownerID)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range favorites {
+		if f.Channel != nil && f.Channel.ID == c.ID {
+			return false, nil
+		}
+	}
+
+	ref := FavoriteRef(c)
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, favoritesKey(scope, ownerID), ref)
+		pipe.HSet(ctx, favoritesNamesKey, ref, c.Name)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add favorite: %w", err)
+	}
+	return true, nil
+}
+
+// RemoveFavorite removes the favorites matching value, either a favorite key
+// or the ID of the channel it resolves to. It returns the removed favorite, or
+// nil when nothing matched.
+func (r *RedisStore) RemoveFavorite(ctx context.Context, scope, ownerID, value string) (*Favorite, error) {
+	favorites, err := r.GetFavorites(ctx, scope, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range favorites {
+		if f.Key != value && (f.Channel == nil || f.Channel.ID != value) {
+			continue
+		}
+		if err := r.Client.SRem(ctx, favoritesKey(scope, ownerID), f.Ref).Err(); err != nil {
+			return nil, fmt.Errorf("failed to remove favorite: %w", err)
+		}
+		return &f, nil
+	}
+	return nil, nil
+}
+
+// GetFavorites returns the favorites of a user or guild resolved against the
+// active catalog, sorted by name.
+func (r *RedisStore) GetFavorites(ctx context.Context, scope, ownerID string) ([]Favorite, error) {
+	refs, err := r.Client.SMembers(ctx, favoritesKey(scope, ownerID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorites: %w", err)
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	names, err := r.Client.HMGet(ctx, favoritesNamesKey, refs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorite names: %w", err)
+	}
+
+	favorites := make([]Favorite, 0, len(refs))
+	for i, ref := range refs {
+		f := Favorite{Key: favoriteKey(ref), Ref: ref}
+		f.Name, _ = names[i].(string)
+
+		id, err := r.resolveFavorite(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+				if c, err := r.GetChannelByID(ctx, n); err == nil {
+					f.Channel = c
+					f.Name = c.Name
+				}
+			}
+		}
+		favorites = append(favorites, f)
+	}
+
+	sort.Slice(favorites, func(i, j int) bool {
+		return strings.ToUpper(favorites[i].Name) < strings.ToUpper(favorites[j].Name)
+	})
+	return favorites, nil
+}
+
+// resolveFavorite returns the ID of the channel a reference points to in the
+// active catalog, or an empty string when it is not there.
+func (r *RedisStore) resolveFavorite(ctx context.Context, ref string) (string, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	tvgID, url, _ := strings.Cut(ref, "|")
+
+	keys := []string{fmt.Sprintf("%s:url:%s", prefix, url)}
+	if tvgID != "" {
+		keys = append(keys, fmt.Sprintf("%s:tvg:%s", prefix, tvgID))
+	}
+	for _, key := range keys {
+		id, err := r.Client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve favorite: %w", err)
+		}
+		return id, nil
+	}
+	return "", nil
+}
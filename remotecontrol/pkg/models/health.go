@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Health of every channel is stored in a hash "health:<channel id>", the IDs
+// of channels whose last check failed are also kept in the "health:dead" set
+// so listings can filter them with a single call.
+const (
+	healthPrefix  = "health"
+	healthDeadKey = "health:dead"
+)
+
+const (
+	HealthUnknown = "unknown"
+	HealthAlive   = "alive"
+	HealthDead    = "dead"
+)
+
+type ChannelHealth struct {
+	Status    string
+	URL       string
+	CheckedAt time.Time
+	Latency   time.Duration
+	Error     string
+}
+
+// Score ranks streams for failover, higher is better: alive streams by
+// latency, then the unchecked ones and the dead ones last.
+func (h *ChannelHealth) Score() int {
+	switch h.Status {
+	case HealthAlive:
+		penalty := int(h.Latency / (100 * time.Millisecond))
+		if penalty > 50 {
+			penalty = 50
+		}
+		return 100 - penalty
+	case HealthDead:
+		return 0
+	}
+	return 25
+}
+
+// SaveChannelHealth stores the result of a health check.
+func (r *RedisStore) SaveChannelHealth(ctx context.Context, channelID string, health ChannelHealth) error {
+	key := fmt.Sprintf("%s:%s", healthPrefix, channelID)
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"status":     health.Status,
+			"url":        health.URL,
+			"checked_at": health.CheckedAt.Unix(),
+			"latency_ms": health.Latency.Milliseconds(),
+			"error":      health.Error,
+		})
+		if health.Status == HealthDead {
+			pipe.SAdd(ctx, healthDeadKey, channelID)
+		} else {
+			pipe.SRem(ctx, healthDeadKey, channelID)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save health of channel %s: %w", channelID, err)
+	}
+	return nil
+}
+
+// GetChannelHealth returns the last health check of a channel. Channels that
+// were never checked, or whose URL changed since the check, are unknown.
+func (r *RedisStore) GetChannelHealth(ctx context.Context, channel *TvChannel) (*ChannelHealth, error) {
+	key := fmt.Sprintf("%s:%s", healthPrefix, channel.ID)
+	data, err := r.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get health of channel %s: %w", channel.ID, err)
+	}
+	if len(data) == 0 || data["url"] != channel.URL {
+		return &ChannelHealth{Status: HealthUnknown, URL: channel.URL}, nil
+	}
+
+	health := &ChannelHealth{
+		Status: data["status"],
+		URL:    data["url"],
+		Error:  data["error"],
+	}
+	if checkedAt, err := strconv.ParseInt(data["checked_at"], 10, 64); err == nil {
+		health.CheckedAt = time.Unix(checkedAt, 0)
+	}
+	if latency, err := strconv.ParseInt(data["latency_ms"], 10, 64); err == nil {
+		health.Latency = time.Duration(latency) * time.Millisecond
+	}
+	return health, nil
+}
+
+// PruneDeadChannels takes out of the dead set the channels that left the
+// catalog or whose URL changed since they were checked, the dead stream is not
+// theirs anymore. It runs after every import, channels keep their IDs across
+// imports.
+func (r *RedisStore) PruneDeadChannels(ctx context.Context, channels []TvChannel) error {
+	ids, err := r.Client.SMembers(ctx, healthDeadKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get dead channels: %w", err)
+	}
+	urls := make(map[string]string, len(channels))
+	for _, channel := range channels {
+		urls[channel.ID] = channel.URL
+	}
+
+	var stale []interface{}
+	var retired []string
+	for _, id := range ids {
+		key := fmt.Sprintf("%s:%s", healthPrefix, id)
+		url, ok := urls[id]
+		if !ok {
+			stale = append(stale, id)
+			retired = append(retired, key)
+			continue
+		}
+		checked, err := r.Client.HGet(ctx, key, "url").Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to get health of channel %s: %w", id, err)
+		}
+		if checked != url {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, healthDeadKey, stale...)
+		if len(retired) > 0 {
+			pipe.Del(ctx, retired...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prune dead channels: %w", err)
+	}
+	return nil
+}
+
+// GetDeadChannels returns the IDs of the channels whose last check failed.
+func (r *RedisStore) GetDeadChannels(ctx context.Context) (map[string]bool, error) {
+	ids, err := r.Client.SMembers(ctx, healthDeadKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead channels: %w", err)
+	}
+	dead := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		dead[id] = true
+	}
+	return dead, nil
+}
+
+// IsChannelDead reports whether the last check of the channel failed.
+func (r *RedisStore) IsChannelDead(ctx context.Context, channelID string) (bool, error) {
+	dead, err := r.Client.SIsMember(ctx, healthDeadKey, channelID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get health of channel %s: %w", channelID, err)
+	}
+	return dead, nil
+}
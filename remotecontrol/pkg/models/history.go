@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Every play is pushed to the head of the "history" list, capped to
+// historySize entries. The head entry stays open until the next play or stop
+// closes it with how long it stayed on.
+const (
+	historyKey  = "history"
+	historySize = 500
+)
+
+// Requester is who asked for a command, plays without one were started by
+// the bot itself.
+type Requester struct {
+	UserID   string
+	UserName string
+	GuildID  string
+}
+
+type requesterKey struct{}
+
+// WithRequester returns a context carrying who asked for the command, the
+// history records it with every play.
+func WithRequester(ctx context.Context, requester Requester) context.Context {
+	return context.WithValue(ctx, requesterKey{}, requester)
+}
+
+// RequesterFromContext returns who asked for the command, if anyone.
+func RequesterFromContext(ctx context.Context) Requester {
+	requester, _ := ctx.Value(requesterKey{}).(Requester)
+	return requester
+}
+
+type historyNoteKey struct{}
+
+// WithHistoryNote returns a context carrying a note on why the channel is
+// played, like the result of the poll that picked it. The history records it
+// with the play.
+func WithHistoryNote(ctx context.Context, note string) context.Context {
+	return context.WithValue(ctx, historyNoteKey{}, note)
+}
+
+type HistoryEntry struct {
+	ID string `json:"id"`
+	// Empty for Youtube videos
+	ChannelID string        `json:"channel_id,omitempty"`
+	URL       string        `json:"url"`
+	Title     string        `json:"title"`
+	UserID    string        `json:"user_id,omitempty"`
+	UserName  string        `json:"user_name,omitempty"`
+	GuildID   string        `json:"guild_id,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Open      bool          `json:"open,omitempty"`
+	Note      string        `json:"note,omitempty"`
+}
+
+// recordPlay closes the open history entry and opens a new one for what is
+// being played. Errors are only logged, the history must not break playback.
+func (r *RedisStore) recordPlay(ctx context.Context, channelID, url, title string) {
+	r.closeHistory(ctx)
+
+	requester := RequesterFromContext(ctx)
+	note, _ := ctx.Value(historyNoteKey{}).(string)
+	entry := HistoryEntry{
+		ID:        NewSessionID(),
+		ChannelID: channelID,
+		URL:       url,
+		Title:     title,
+		UserID:    requester.UserID,
+		UserName:  requester.UserName,
+		GuildID:   requester.GuildID,
+		StartedAt: time.Now(),
+		Open:      true,
+		Note:      note,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error marshaling history entry: %v", err)
+		return
+	}
+
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, historyKey, data)
+		pipe.LTrim(ctx, historyKey, 0, historySize-1)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving history entry: %v", err)
+	}
+}
+
+// openRequester returns who asked for what the open history entry plays,
+// nobody when no entry is open.
+func (r *RedisStore) openRequester(ctx context.Context) Requester {
+	data, err := r.Client.LIndex(ctx, historyKey, 0).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error getting history entry: %v", err)
+		}
+		return Requester{}
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(data, &entry); err != nil || !entry.Open {
+		return Requester{}
+	}
+	return Requester{UserID: entry.UserID, UserName: entry.UserName, GuildID: entry.GuildID}
+}
+
+// closeHistory records how long the open history entry stayed on.
+func (r *RedisStore) closeHistory(ctx context.Context) {
+	data, err := r.Client.LIndex(ctx, historyKey, 0).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error getting history entry: %v", err)
+		}
+		return
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("Error unmarshaling history entry: %v", err)
+		return
+	}
+	if !entry.Open {
+		return
+	}
+	entry.Open = false
+	entry.Duration = time.Since(entry.StartedAt).Round(time.Second)
+
+	if data, err = json.Marshal(entry); err != nil {
+		log.Printf("Error marshaling history entry: %v", err)
+		return
+	}
+	if err := r.Client.LSet(ctx, historyKey, 0, data).Err(); err != nil {
+		log.Printf("Error saving history entry: %v", err)
+	}
+}
+
+// GetHistory returns one page of the history, most recent first, and the
+// number of entries. Pages start at 0.
+func (r *RedisStore) GetHistory(ctx context.Context, page, pageSize int) ([]HistoryEntry, int, error) {
+	var total *redis.IntCmd
+	var items *redis.StringSliceCmd
+	start := int64(page * pageSize)
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.LLen(ctx, historyKey)
+		items = pipe.LRange(ctx, historyKey, start, start+int64(pageSize)-1)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	entries := make([]HistoryEntry, 0, len(items.Val()))
+	for _, item := range items.Val() {
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			log.Printf("Error unmarshaling history entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, int(total.Val()), nil
+}
+
+// GetHistoryEntry finds a history entry by its ID.
+func (r *RedisStore) GetHistoryEntry(ctx context.Context, id string) (*HistoryEntry, error) {
+	items, err := r.Client.LRange(ctx, historyKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	for _, item := range items {
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		if entry.ID == id {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("history entry not found: %s", id)
+}
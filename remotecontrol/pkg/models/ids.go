@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Channel IDs are allocated from a persistent map of stable channel identities
+// so the numbers people use with /tv survive playlist refreshes and reorders.
+// These keys live outside the "channel:*" keyspace on purpose, DeleteAll must
+// not reset them.
+const (
+	channelIDMapKey     = "channelid:map"
+	channelIDNextKey    = "channelid:next"
+	channelIDRetiredKey = "channelid:retired"
+)
+
+// NormalizeName upper-cases a channel name and collapses punctuation and
+// whitespace so small formatting changes in the playlist don't change identity.
+func NormalizeName(name string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range strings.ToUpper(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return sb.String()
+}
+
+// ChannelIdentity returns the stable key of a channel: its tvg-id when the
+// playlist provides one, otherwise the normalized name plus the stream URL.
+func ChannelIdentity(c TvChannel) string {
+	if c.TvgID != "" {
+		return "tvg:" + c.TvgID
+	}
+	return nameURLIdentity(c)
+}
+
+func nameURLIdentity(c TvChannel) string {
+	return fmt.Sprintf("name:%s|%s", NormalizeName(c.Name), c.URL)
+}
+
+// AllocateChannelIDs sets the ID of every channel in the slice using the
+// persistent identity map. Known channels keep their ID, new channels get a
+// fresh one and channels missing from this import are marked as retired.
+// IDs are never reused, a retired channel that comes back gets its old ID.
+func (r *RedisStore) AllocateChannelIDs(ctx context.Context, channels []TvChannel) error {
+	known, err := r.Client.HGetAll(ctx, channelIDMapKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load channel id map: %w", err)
+	}
+
+	used := make(map[string]bool, len(channels))
+	active := make(map[string]bool, len(channels))
+	newIDs := make(map[string]interface{})
+	for i := range channels {
+		key := ChannelIdentity(channels[i])
+		if used[key] {
+			// Same tvg-id listed more than once (HD/SD variants, backups)
+			key = nameURLIdentity(channels[i])
+		}
+		for n := 2; used[key]; n++ {
+			key = fmt.Sprintf("%s#%d", ChannelIdentity(channels[i]), n)
+		}
+		used[key] = true
+
+		id, ok := known[key]
+		if !ok {
+			next, err := r.Client.Incr(ctx, channelIDNextKey).Result()
+			if err != nil {
+				return fmt.Errorf("failed to allocate channel id: %w", err)
+			}
+			id = strconv.FormatInt(next-1, 10) // The first ID is 0
+			newIDs[key] = id
+		}
+		channels[i].ID = id
+		active[id] = true
+	}
+
+	if len(newIDs) > 0 {
+		if err := r.Client.HSet(ctx, channelIDMapKey, newIDs).Err(); err != nil {
+			return fmt.Errorf("failed to save channel id map: %w", err)
+		}
+	}
+
+	var retired, revived []interface{}
+	for _, id := range known {
+		if active[id] {
+			revived = append(revived, id)
+		} else {
+			retired = append(retired, id)
+		}
+	}
+	if len(retired) > 0 {
+		if err := r.Client.SAdd(ctx, channelIDRetiredKey, retired...).Err(); err != nil {
+			return fmt.Errorf("failed to retire channel ids: %w", err)
+		}
+	}
+	if len(revived) > 0 {
+		if err := r.Client.SRem(ctx, channelIDRetiredKey, revived...).Err(); err != nil {
+			return fmt.Errorf("failed to revive channel ids: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetChannelIDRange returns the lowest and highest active channel IDs.
+// Active IDs may have gaps where channels were retired.
+func (r *RedisStore) GetChannelIDRange(ctx context.Context) (int64, int64, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	idsKey := fmt.Sprintf("%s:ids", prefix)
+	first, err := r.Client.ZRangeWithScores(ctx, idsKey, 0, 0).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get channel id range: %w", err)
+	}
+	last, err := r.Client.ZRangeWithScores(ctx, idsKey, -1, -1).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get channel id range: %w", err)
+	}
+	if len(first) == 0 || len(last) == 0 {
+		return 0, 0, nil
+	}
+	return int64(first[0].Score), int64(last[0].Score), nil
+}
@@ -2,10 +2,12 @@ package models
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -13,14 +15,70 @@ import (
 )
 
 type TvChannel struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	TvgID      string            `json:"tvg_id,omitempty"`
+	TvgName    string            `json:"tvg_name,omitempty"`
+	Logo       string            `json:"logo,omitempty"`
+	Group      string            `json:"group,omitempty"`
+	Duration   float64           `json:"duration,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Source     string            `json:"source,omitempty"`
+}
+
+// toHash converts a TvChannel into the field map stored in the channel hash.
+func (c TvChannel) toHash() map[string]interface{} {
+	fields := map[string]interface{}{
+		"id":       c.ID,
+		"name":     strings.ToUpper(c.Name),
+		"url":      c.URL,
+		"tvg_id":   c.TvgID,
+		"tvg_name": c.TvgName,
+		"logo":     c.Logo,
+		"group":    c.Group,
+		"duration": strconv.FormatFloat(c.Duration, 'f', -1, 64),
+		"source":   c.Source,
+	}
+	if len(c.Attributes) > 0 {
+		if attrs, err := json.Marshal(c.Attributes); err == nil {
+			fields["attrs"] = string(attrs)
+		}
+	}
+	return fields
+}
+
+// channelFromHash builds a TvChannel from the fields of a channel hash.
+// Missing fields are left empty so hashes written by older versions still load.
+func channelFromHash(data map[string]string) *TvChannel {
+	channel := &TvChannel{
+		ID:       data["id"],
+		Name:     data["name"],
+		URL:      data["url"],
+		TvgID:    data["tvg_id"],
+		TvgName:  data["tvg_name"],
+		Logo:     data["logo"],
+		Group:    data["group"],
+		Source:   data["source"],
+		Duration: -1,
+	}
+	if d, err := strconv.ParseFloat(data["duration"], 64); err == nil {
+		channel.Duration = d
+	}
+	if attrs := data["attrs"]; attrs != "" {
+		if err := json.Unmarshal([]byte(attrs), &channel.Attributes); err != nil {
+			log.Printf("Invalid attributes for channel %s: %v", channel.ID, err)
+		}
+	}
+	return channel
 }
 
 type RedisStore struct {
 	Client *redis.Client
 	Prefix string
+
+	// version pins the store to a catalog version during imports
+	version int64
 }
 
 func NewAuthenticatedRedisClient(ctx context.Context) (*RedisStore, error) {
@@ -54,39 +112,50 @@ func newRedisClient(ctx context.Context, addr, password string, db int) (*RedisS
 	return &RedisStore{Client: rdb}, nil
 }
 
-// Save stores a TvChannel object in Redis.
+// Save stores a TvChannel object in Redis along with its lookup and search
+// indexes. All writes go in a single pipeline.
 // If the operation fails, it returns an error, otherwise it returns nil.
 // The context parameter can be used to control timeout and cancellation.
 func (r *RedisStore) Save(ctx context.Context, tvChannel TvChannel) error {
-	// Set a hash with channel information
-	channelKey := fmt.Sprintf("%s:%s", r.Prefix, tvChannel.ID)
-	_, err := r.Client.HSet(ctx, channelKey, map[string]interface{}{
-		"id":   tvChannel.ID,
-		"name": strings.ToUpper(tvChannel.Name),
-		"url":  tvChannel.URL,
-	}).Result()
+	prefix, err := r.catalogPrefix(ctx)
 	if err != nil {
 		return err
 	}
-
-	// Increase counter
-	if err := r.Client.Incr(ctx, fmt.Sprintf("%s:counter", r.Prefix)).Err(); err != nil {
-		return err
+	idScore, err := strconv.ParseFloat(tvChannel.ID, 64)
+	if err != nil {
+		return fmt.Errorf("invalid channel id %q: %w", tvChannel.ID, err)
 	}
 
-	// Set indexes for id, name and URL
-	idKey := fmt.Sprintf("%s:id:%s", r.Prefix, tvChannel.ID)
-	if err := r.Client.Set(ctx, idKey, tvChannel.ID, 0).Err(); err != nil {
-		return err
-	}
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		// Set a hash with channel information
+		channelKey := fmt.Sprintf("%s:%s", prefix, tvChannel.ID)
+		pipe.HSet(ctx, channelKey, tvChannel.toHash())
 
-	nameKey := fmt.Sprintf("%s:name:%s", r.Prefix, strings.ToUpper(tvChannel.Name))
-	if err := r.Client.Set(ctx, nameKey, tvChannel.ID, 0).Err(); err != nil {
-		return err
-	}
+		// Increase counter
+		pipe.Incr(ctx, fmt.Sprintf("%s:counter", prefix))
+
+		// Register the ID in the set of active channels
+		idsKey := fmt.Sprintf("%s:ids", prefix)
+		pipe.ZAdd(ctx, idsKey, &redis.Z{Score: idScore, Member: tvChannel.ID})
+
+		// Set indexes for id, name, URL and tvg-id
+		pipe.Set(ctx, fmt.Sprintf("%s:id:%s", prefix, tvChannel.ID), tvChannel.ID, 0)
+		pipe.Set(ctx, fmt.Sprintf("%s:name:%s", prefix, strings.ToUpper(tvChannel.Name)), tvChannel.ID, 0)
+		pipe.Set(ctx, fmt.Sprintf("%s:url:%s", prefix, tvChannel.URL), tvChannel.ID, 0)
+		if tvChannel.TvgID != "" {
+			pipe.Set(ctx, fmt.Sprintf("%s:tvg:%s", prefix, strings.ToLower(tvChannel.TvgID)), tvChannel.ID, 0)
+		}
+
+		// Group the entries of the same logical channel, see GetAlternates
+		for _, key := range alternateKeys(prefix, tvChannel) {
+			pipe.SAdd(ctx, key, tvChannel.ID)
+		}
 
-	urlKey := fmt.Sprintf("%s:url:%s", r.Prefix, tvChannel.URL)
-	if err := r.Client.Set(ctx, urlKey, tvChannel.ID, 0).Err(); err != nil {
+		// Full text search index
+		indexChannel(ctx, pipe, prefix, tvChannel)
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -98,8 +167,12 @@ func (r *RedisStore) Save(ctx context.Context, tvChannel TvChannel) error {
 // It takes a context.Context and a channel ID as parameters.
 // Returns a pointer to TvChannel if found, or an error if the operation fails.
 func (r *RedisStore) GetChannelByID(ctx context.Context, id int64) (*TvChannel, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
 	id_str := strconv.FormatInt(id, 10)
-	channelKey := fmt.Sprintf("%s:%s", r.Prefix, id_str)
+	channelKey := fmt.Sprintf("%s:%s", prefix, id_str)
 
 	data, err := r.Client.HGetAll(ctx, channelKey).Result()
 	if err != nil {
@@ -110,44 +183,23 @@ func (r *RedisStore) GetChannelByID(ctx context.Context, id int64) (*TvChannel,
 		return nil, fmt.Errorf("channel not found: %s", id_str)
 	}
 
-	channel := &TvChannel{
-		ID:   data["id"],
-		Name: data["name"],
-		URL:  data["url"],
-	}
+	channel := channelFromHash(data)
 
 	log.Printf("Retrieved channel %s", channel.Name)
 
 	return channel, nil
 }
 
-// DeleteAll removes all entries from the Redis store. This operation clears all key-value pairs
-// stored in the Redis database associated with this store instance.
-// It requires a context for cancellation and timeout control.
-// Returns an error if the operation fails, nil otherwise.
-func (r *RedisStore) DeleteAll(ctx context.Context) error {
-	pattern := fmt.Sprintf("%s:*", r.Prefix)
-	iter := r.Client.Scan(ctx, 0, pattern, 0).Iterator()
-
-	for iter.Next(ctx) {
-		if err := r.Client.Del(ctx, iter.Val()).Err(); err != nil {
-			return fmt.Errorf("failed to delete key %s: %w", iter.Val(), err)
-		}
-	}
-
-	if err := iter.Err(); err != nil {
-		return fmt.Errorf("scan failed: %w", err)
-	}
-
-	return nil
-}
-
 // GetChannelCounter retrieves the current counter value from Redis.
 // The counter is stored with a key formatted as "{prefix}:counter".
 // If the counter doesn't exist in Redis, it returns 0 without error.
 // Returns the counter value and any error encountered during the operation.
 func (r *RedisStore) GetChannelCounter(ctx context.Context) (int64, error) {
-	counterKey := fmt.Sprintf("%s:counter", r.Prefix)
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	counterKey := fmt.Sprintf("%s:counter", prefix)
 	count, err := r.Client.Get(ctx, counterKey).Int64()
 	if err != nil {
 		if err == redis.Nil {
@@ -158,14 +210,18 @@ func (r *RedisStore) GetChannelCounter(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
-// SearchChannelsByName searches for TV channels whose names match the given search pattern.
-// The search is case-sensitive and uses Redis pattern matching.
-// Returns a slice of TvChannel objects and any error encountered.
-func (r *RedisStore) SearchChannelsByName(ctx context.Context, searchTerm string) ([]TvChannel, error) {
+// scanChannelsByName searches for TV channels whose names match the given search pattern
+// using Redis pattern matching. It is only used for catalogs imported before the search
+// index existed.
+func (r *RedisStore) scanChannelsByName(ctx context.Context, searchTerm string) ([]TvChannel, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
 	// Split the search term by spaces and join with *
 	searchTerm = strings.Join(strings.Fields(searchTerm), "*")
 	searchTermUpper := strings.ToUpper(searchTerm)
-	pattern := fmt.Sprintf("%s:name:*%s*", r.Prefix, searchTermUpper)
+	pattern := fmt.Sprintf("%s:name:*%s*", prefix, searchTermUpper)
 	var channels []TvChannel
 
 	iter := r.Client.Scan(ctx, 0, pattern, 0).Iterator()
@@ -176,18 +232,14 @@ func (r *RedisStore) SearchChannelsByName(ctx context.Context, searchTerm string
 			continue
 		}
 
-		channelKey := fmt.Sprintf("%s:%s", r.Prefix, channelID)
+		channelKey := fmt.Sprintf("%s:%s", prefix, channelID)
 		data, err := r.Client.HGetAll(ctx, channelKey).Result()
 		if err != nil {
 			continue
 		}
 
 		if len(data) > 0 {
-			channels = append(channels, TvChannel{
-				ID:   data["id"],
-				Name: data["name"],
-				URL:  data["url"],
-			})
+			channels = append(channels, *channelFromHash(data))
 		}
 	}
 
@@ -195,32 +247,81 @@ func (r *RedisStore) SearchChannelsByName(ctx context.Context, searchTerm string
 		return nil, fmt.Errorf("scan failed: %w", err)
 	}
 
+	// Names starting with the search term first, then the shortest names
+	sort.SliceStable(channels, func(i, j int) bool {
+		pi := strings.HasPrefix(channels[i].Name, searchTermUpper)
+		pj := strings.HasPrefix(channels[j].Name, searchTermUpper)
+		if pi != pj {
+			return pi
+		}
+		if len(channels[i].Name) != len(channels[j].Name) {
+			return len(channels[i].Name) < len(channels[j].Name)
+		}
+		return channels[i].Name < channels[j].Name
+	})
+
 	return channels, nil
 }
 
-// GetRandomChannel retrieves a random channel ID from the Redis store.
-// It first gets the total channel count using GetChannelCounter and then
-// generates a random number between 0 and count-1.
+// GetRandomChannel retrieves a random channel ID from the set of active
+// channel IDs. IDs are not contiguous, retired channels leave gaps.
 //
 // The context parameter is used for cancellation and timeout control.
 //
 // Returns:
-//   - int64: A random channel ID between 0 and (channel count - 1)
-//   - error: An error if the channel counter could not be retrieved
+//   - int64: The ID of a random active channel
+//   - error: An error if there are no channels or the set could not be read
 func (r *RedisStore) GetRandomChannel(ctx context.Context) (int64, error) {
-	count, err := r.GetChannelCounter(ctx)
+	prefix, err := r.catalogPrefix(ctx)
 	if err != nil {
 		return 0, err
 	}
-	id := rand.Int63n(count)
+	idsKey := fmt.Sprintf("%s:ids", prefix)
+	ids, err := r.Client.ZRandMember(ctx, idsKey, 1, false).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get random channel id: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("no channels available")
+	}
 
-	return id, nil
+	return strconv.ParseInt(ids[0], 10, 64)
 }
 
+// RegisterCurrentChannel stores the channel being played, the one it replaces
+// is kept as the last channel for /back.
 func (r *RedisStore) RegisterCurrentChannel(ctx context.Context, tvChannel *TvChannel) error {
 	id := tvChannel.ID
 	key := fmt.Sprintf("%s:current", r.Prefix)
-	return r.Client.Set(ctx, key, id, 0).Err()
+	previous, err := r.Client.GetSet(ctx, key, id).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if previous != "" && previous != id {
+		return r.Client.Set(ctx, fmt.Sprintf("%s:last", r.Prefix), previous, 0).Err()
+	}
+	return nil
+}
+
+// replaceCurrentChannel stores the channel being played in place of the
+// current one, the last channel for /back stays as it is.
+func (r *RedisStore) replaceCurrentChannel(ctx context.Context, tvChannel *TvChannel) error {
+	key := fmt.Sprintf("%s:current", r.Prefix)
+	return r.Client.Set(ctx, key, tvChannel.ID, 0).Err()
+}
+
+// GetCurrentChannelID returns the ID of the last channel played, which may not
+// be in the catalog anymore, or an empty string when nothing was played yet.
+func (r *RedisStore) GetCurrentChannelID(ctx context.Context) (string, error) {
+	key := fmt.Sprintf("%s:current", r.Prefix)
+	id, err := r.Client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get current channel: %w", err)
+	}
+	return id, nil
 }
 
 func (r *RedisStore) GetCurrentChannel(ctx context.Context) (*TvChannel, error) {
@@ -242,33 +343,51 @@ func (r *RedisStore) GetCurrentChannel(ctx context.Context) (*TvChannel, error)
 	return channel, nil
 }
 
-func (r *RedisStore) GetAllChannels(ctx context.Context) (string, error) {
-	pattern := fmt.Sprintf("%s:[0-9]*", r.Prefix)
-	var channels []*TvChannel
+// ListChannels returns every channel of the active catalog ordered by ID.
+func (r *RedisStore) ListChannels(ctx context.Context) ([]*TvChannel, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := r.Client.ZRange(ctx, fmt.Sprintf("%s:ids", prefix), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channel ids: %w", err)
+	}
 
-	iter := r.Client.Scan(ctx, 0, pattern, 0).Iterator()
-	for iter.Next(ctx) {
-		data, err := r.Client.HGetAll(ctx, iter.Val()).Result()
-		if err != nil {
-			continue
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, fmt.Sprintf("%s:%s", prefix, id))
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channels: %w", err)
+	}
 
-		if len(data) > 0 {
-			channel := &TvChannel{
-				ID:   data["id"],
-				Name: data["name"],
-			}
-			channels = append(channels, channel)
+	channels := make([]*TvChannel, 0, len(ids))
+	for _, cmd := range cmds {
+		if data := cmd.Val(); len(data) > 0 {
+			channels = append(channels, channelFromHash(data))
 		}
 	}
+	return channels, nil
+}
 
-	if err := iter.Err(); err != nil {
-		return "", fmt.Errorf("scan failed: %w", err)
+func (r *RedisStore) GetAllChannels(ctx context.Context) (string, error) {
+	channels, err := r.ListChannels(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	channelsCsv := channels2Csv(channels)
+	dead, err := r.GetDeadChannels(ctx)
+	if err != nil {
+		log.Printf("Error getting channel health: %v", err)
+	}
+
+	channelsCsv := channels2Csv(channels, dead)
 	fileName := fmt.Sprintf("/data/%s-catalog.csv", r.Prefix)
-	err := os.WriteFile(fileName, channelsCsv, 0644)
+	err = os.WriteFile(fileName, channelsCsv, 0644)
 	if err != nil {
 		fmt.Printf("Error writing channels to file: %v\n", err)
 	}
@@ -276,11 +395,17 @@ func (r *RedisStore) GetAllChannels(ctx context.Context) (string, error) {
 
 }
 
-func channels2Csv(channels []*TvChannel) []byte {
+func channels2Csv(channels []*TvChannel, dead map[string]bool) []byte {
 	var sb strings.Builder
-	sb.WriteString("ID,Name\n")
+	w := csv.NewWriter(&sb)
+	w.Write([]string{"ID", "Name", "Group", "Source", "TvgID", "Logo", "Status"})
 	for _, channel := range channels {
-		sb.WriteString(fmt.Sprintf("%s,%s\n", channel.ID, channel.Name))
+		status := ""
+		if dead[channel.ID] {
+			status = HealthDead
+		}
+		w.Write([]string{channel.ID, channel.Name, channel.Group, channel.Source, channel.TvgID, channel.Logo, status})
 	}
+	w.Flush()
 	return []byte(sb.String())
 }
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// What the TV is doing is kept in the "channel:playback" hash. Every change
+// is announced on playbackUpdatesChannel so the remote panels refresh no
+// matter which command changed the channel.
+const (
+	playbackUpdatesChannel = "tvbarrapesada:playback"
+	// Hash of Discord text channel ID to the message ID of its remote panel
+	panelsKey = "panel:messages"
+	// Messages for the people watching, such as a failover, see PublishNotice
+	noticesChannel = "tvbarrapesada:notices"
+)
+
+type PlaybackState struct {
+	Playing bool
+	// Empty when playing a Youtube video
+	ChannelID string
+	Title     string
+	UpdatedAt time.Time
+}
+
+func (r *RedisStore) setPlayback(ctx context.Context, state PlaybackState) error {
+	key := fmt.Sprintf("%s:playback", r.Prefix)
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"playing":    strconv.FormatBool(state.Playing),
+			"channel_id": state.ChannelID,
+			"title":      state.Title,
+			"updated_at": time.Now().Unix(),
+		})
+		pipe.Publish(ctx, playbackUpdatesChannel, state.ChannelID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save playback state: %w", err)
+	}
+	return nil
+}
+
+// GetPlayback returns what the TV is doing. A TV that never played anything
+// is reported as stopped.
+func (r *RedisStore) GetPlayback(ctx context.Context) (*PlaybackState, error) {
+	key := fmt.Sprintf("%s:playback", r.Prefix)
+	data, err := r.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playback state: %w", err)
+	}
+
+	state := &PlaybackState{
+		ChannelID: data["channel_id"],
+		Title:     data["title"],
+	}
+	state.Playing, _ = strconv.ParseBool(data["playing"])
+	if ts, err := strconv.ParseInt(data["updated_at"], 10, 64); err == nil {
+		state.UpdatedAt = time.Unix(ts, 0)
+	}
+	return state, nil
+}
+
+// SubscribePlayback subscribes to playback changes, the caller must close the
+// returned PubSub.
+func (r *RedisStore) SubscribePlayback(ctx context.Context) *redis.PubSub {
+	return r.Client.Subscribe(ctx, playbackUpdatesChannel)
+}
+
+// SavePanel registers the remote panel message of a Discord channel and
+// returns the ID of the panel it replaces, if any.
+func (r *RedisStore) SavePanel(ctx context.Context, channelID, messageID string) (string, error) {
+	var previous *redis.StringCmd
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		previous = pipe.HGet(ctx, panelsKey, channelID)
+		pipe.HSet(ctx, panelsKey, channelID, messageID)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return "", fmt.Errorf("failed to save panel: %w", err)
+	}
+	return previous.Val(), nil
+}
+
+// GetPanels returns the remote panels by Discord channel ID.
+func (r *RedisStore) GetPanels(ctx context.Context) (map[string]string, error) {
+	panels, err := r.Client.HGetAll(ctx, panelsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get panels: %w", err)
+	}
+	return panels, nil
+}
+
+// DeletePanel forgets the panel of a Discord channel unless it was replaced
+// by a newer message meanwhile.
+func (r *RedisStore) DeletePanel(ctx context.Context, channelID, messageID string) error {
+	current, err := r.Client.HGet(ctx, panelsKey, channelID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get panel: %w", err)
+	}
+	if current != messageID {
+		return nil
+	}
+	return r.Client.HDel(ctx, panelsKey, channelID).Err()
+}
+
+// PublishNotice announces something people should know about the TV, the bot
+// posts it to the notices channel.
+func (r *RedisStore) PublishNotice(ctx context.Context, text string) error {
+	if err := r.Client.Publish(ctx, noticesChannel, text).Err(); err != nil {
+		return fmt.Errorf("failed to publish notice: %w", err)
+	}
+	return nil
+}
+
+// SubscribeNotices subscribes to the notices, the caller must close the
+// returned PubSub.
+func (r *RedisStore) SubscribeNotices(ctx context.Context) *redis.PubSub {
+	return r.Client.Subscribe(ctx, noticesChannel)
+}
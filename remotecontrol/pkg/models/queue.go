@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The play queue is the "queue" list, next item first. While an item taken
+// from the queue is playing it is kept in "queue:current", so an ended
+// event from the streamer for that item advances the queue. Anything played
+// outside the queue clears it and the queue waits for /skip or a new item.
+const (
+	queueKey        = "queue"
+	queueCurrentKey = "queue:current"
+	MaxQueueLength  = 100
+)
+
+type QueueItem struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	Title    string    `json:"title"`
+	UserName string    `json:"user_name,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// Enqueue adds a Youtube video or media URL to the end of the queue and
+// returns it with its position, starting at 1.
+func (r *RedisStore) Enqueue(ctx context.Context, mediaURL string) (*QueueItem, int64, error) {
+	length, err := r.Client.LLen(ctx, queueKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get queue length: %w", err)
+	}
+	if length >= MaxQueueLength {
+		return nil, 0, fmt.Errorf("queue is full (%d items)", MaxQueueLength)
+	}
+
+	item := &QueueItem{
+		ID:       NewSessionID(),
+		URL:      mediaURL,
+		Title:    mediaTitle(mediaURL),
+		UserName: RequesterFromContext(ctx).UserName,
+		AddedAt:  time.Now(),
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal queue item: %w", err)
+	}
+
+	position, err := r.Client.RPush(ctx, queueKey, data).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to add to queue: %w", err)
+	}
+	return item, position, nil
+}
+
+// GetQueue returns the items waiting in the queue, next first.
+func (r *RedisStore) GetQueue(ctx context.Context) ([]QueueItem, error) {
+	items, err := r.Client.LRange(ctx, queueKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue: %w", err)
+	}
+
+	queue := make([]QueueItem, 0, len(items))
+	for _, data := range items {
+		var item QueueItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			log.Printf("Error unmarshaling queue item: %v", err)
+			continue
+		}
+		queue = append(queue, item)
+	}
+	return queue, nil
+}
+
+// GetQueueCurrent returns the queue item playing now, or nil when the TV is
+// not playing from the queue.
+func (r *RedisStore) GetQueueCurrent(ctx context.Context) (*QueueItem, error) {
+	data, err := r.Client.Get(ctx, queueCurrentKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current queue item: %w", err)
+	}
+
+	var item QueueItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queue item: %w", err)
+	}
+	return &item, nil
+}
+
+// RemoveFromQueue removes the item at the given position, starting at 1, and
+// returns it.
+func (r *RedisStore) RemoveFromQueue(ctx context.Context, position int64) (*QueueItem, error) {
+	data, err := r.Client.LIndex(ctx, queueKey, position-1).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("no item at position %d", position)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue item: %w", err)
+	}
+	if err := r.Client.LRem(ctx, queueKey, 1, data).Err(); err != nil {
+		return nil, fmt.Errorf("failed to remove queue item: %w", err)
+	}
+
+	var item QueueItem
+	if err := json.Unmarshal([]byte(data), &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queue item: %w", err)
+	}
+	return &item, nil
+}
+
+// ClearQueue removes every item waiting in the queue and returns how many
+// there were.
+func (r *RedisStore) ClearQueue(ctx context.Context) (int64, error) {
+	var length *redis.IntCmd
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.LLen(ctx, queueKey)
+		pipe.Del(ctx, queueKey)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear queue: %w", err)
+	}
+	return length.Val(), nil
+}
+
+// PlayNext plays the next item of the queue and returns it. When the queue is
+// empty it returns nil and, if the TV was playing from the queue, stops it.
+func (r *RedisStore) PlayNext(ctx context.Context) (*QueueItem, error) {
+	data, err := r.Client.LPop(ctx, queueKey).Result()
+	if err == redis.Nil {
+		current, err := r.GetQueueCurrent(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			return nil, r.Stop(ctx)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next queue item: %w", err)
+	}
+
+	var item QueueItem
+	if err := json.Unmarshal([]byte(data), &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queue item: %w", err)
+	}
+
+	// Set before playing, a broken item may fail before playURL returns
+	if err := r.Client.Set(ctx, queueCurrentKey, data, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to set current queue item: %w", err)
+	}
+	if err := r.playURL(ctx, item.URL, item.Title); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// leaveQueue marks the TV as not playing from the queue anymore.
+func (r *RedisStore) leaveQueue(ctx context.Context) {
+	if err := r.Client.Del(ctx, queueCurrentKey).Err(); err != nil {
+		log.Printf("Error clearing current queue item: %v", err)
+	}
+}
+
+// mediaTitle returns the Youtube title of a URL, or its file name for other
+// media.
+func mediaTitle(mediaURL string) string {
+	if title, err := getYoutubeTitle(mediaURL); err == nil {
+		return title
+	}
+	if u, err := url.Parse(mediaURL); err == nil && u.Path != "" && u.Path != "/" {
+		return path.Base(u.Path)
+	}
+	return mediaURL
+}
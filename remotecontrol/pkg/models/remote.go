@@ -5,80 +5,127 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/kkdai/youtube/v2"
 )
 
+// Commands reach the streamer through the commandsStream Redis stream, read
+// by a consumer group so commands sent while the streamer is down wait for
+// it. They are sent by the reconciler only, Play, Stop and friends change the
+// desired state in desiredStateKey, see desired.go. When the streamer boots it
+// drops its backlog and replays the desired state.
 const (
-	remoteControlChannel = "tvbarrapesada"
+	commandsStream  = "tvbarrapesada:commands"
+	desiredStateKey = "tvbarrapesada:desired"
+	// Entries kept in the stream, approximately
+	commandsStreamMaxLen = 1000
+	// Commands the streamer did not handle in time are dropped
+	commandTTL = time.Minute
 )
 
 type ChannelCommand struct {
 	Command string `json:"command"`
 	Tittle  string `json:"title"`
 	URL     string `json:"url"`
+	// Correlation ID echoed back in the streamer events, see WithCommandID
+	ID        string         `json:"id,omitempty"`
+	Options   *StreamOptions `json:"options,omitempty"`
+	ExpiresAt time.Time      `json:"expires_at"`
 }
 
+// Play switches the TV to the channel with the given ID and registers it as
+// the current channel.
 func (r *RedisStore) Play(ctx context.Context, id int64) error {
-	// Stop any previous channel and wait one second
-	r.Stop(ctx)
-	time.Sleep(2 * time.Second)
+	r.leaveQueue(ctx)
+
 	r.Prefix = "channel"
 	tvChannel, err := r.GetChannelByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to get channel by id: %w", err)
 	}
 
-	command := ChannelCommand{
-		Command: "play",
-		Tittle:  tvChannel.Name,
-		URL:     tvChannel.URL,
-	}
-
-	jsonData, err := json.Marshal(command)
+	err = r.setDesired(ctx, DesiredState{
+		Command:   "play",
+		Title:     tvChannel.Name,
+		URL:       tvChannel.URL,
+		ChannelID: tvChannel.ID,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal command: %w", err)
+		return err
 	}
 
-	log.Printf("Sending command: %+v", jsonData)
-	return r.Client.Publish(ctx, remoteControlChannel, jsonData).Err()
+	r.recordPlay(ctx, tvChannel.ID, tvChannel.URL, tvChannel.Name)
+	if err := r.RegisterCurrentChannel(ctx, tvChannel); err != nil {
+		return fmt.Errorf("failed to register current channel: %w", err)
+	}
+	return r.setPlayback(ctx, PlaybackState{Playing: true, ChannelID: tvChannel.ID, Title: tvChannel.Name})
 }
 
 func (r *RedisStore) Stop(ctx context.Context) error {
 	r.Prefix = "channel"
-	command := ChannelCommand{
-		Command: "stop",
+	r.leaveQueue(ctx)
+	if err := r.setDesired(ctx, DesiredState{Command: "stop"}); err != nil {
+		return err
 	}
-
-	jsonData, err := json.Marshal(command)
-	if err != nil {
-		return fmt.Errorf("failed to marshal command: %w", err)
-	}
-
-	log.Printf("Sending command: %+v", jsonData)
-	return r.Client.Publish(ctx, remoteControlChannel, jsonData).Err()
+	r.closeHistory(ctx)
+	return r.setPlayback(ctx, PlaybackState{Playing: false})
 }
 
+// Restart marks the desired state as dirty, the reconciler restarts the
+// streamer and it plays the desired state again once it is back.
 func (r *RedisStore) Restart(ctx context.Context) error {
 	r.Prefix = "channel"
-	command := ChannelCommand{
-		Command: "restart",
-	}
+	return r.updateDesired(ctx, true, func(state *DesiredState) bool {
+		state.Dirty = true
+		return true
+	})
+}
 
+func (r *RedisStore) publishCommand(ctx context.Context, command ChannelCommand) error {
+	command.ID = commandIDFromContext(ctx)
+	command.ExpiresAt = time.Now().Add(commandTTL)
 	jsonData, err := json.Marshal(command)
 	if err != nil {
 		return fmt.Errorf("failed to marshal command: %w", err)
 	}
 
-	log.Printf("Sending command: %+v", jsonData)
-	return r.Client.Publish(ctx, remoteControlChannel, jsonData).Err()
+	log.Printf("Sending command: %s", jsonData)
+	err = r.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: commandsStream,
+		MaxLen: commandsStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": jsonData},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
 }
 
+// Number of random picks RandomChannel makes before settling for a channel
+// the health prober marked as dead
+const randomChannelAttempts = 10
+
 func (r *RedisStore) RandomChannel(ctx context.Context) (*TvChannel, error) {
-	randChannel, err := r.GetRandomChannel(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get random channel: %w", err)
+	var randChannel int64
+	for attempt := 0; attempt < randomChannelAttempts; attempt++ {
+		id, err := r.GetRandomChannel(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get random channel: %w", err)
+		}
+		randChannel = id
+
+		dead, err := r.IsChannelDead(ctx, strconv.FormatInt(id, 10))
+		if err != nil {
+			log.Printf("Error checking channel health: %v", err)
+			break
+		}
+		if !dead {
+			break
+		}
 	}
 
 	channel, err := r.GetChannelByID(ctx, randChannel)
@@ -90,28 +137,31 @@ func (r *RedisStore) RandomChannel(ctx context.Context) (*TvChannel, error) {
 }
 
 func (r *RedisStore) PlayYoutube(ctx context.Context, url string) (tittle string, err error) {
-	r.Stop(ctx)
-	time.Sleep(2 * time.Second)
-
-	r.Prefix = "channel"
 	videoTitle, err := getYoutubeTitle(url)
 	if err != nil {
 		log.Printf("failed to get youtube title: %v", err)
 		videoTitle = "Youtube Video"
 	}
-	command := ChannelCommand{
+
+	r.leaveQueue(ctx)
+	return videoTitle, r.playURL(ctx, url, videoTitle)
+}
+
+// playURL plays media that is not in the catalog, Youtube videos or files.
+func (r *RedisStore) playURL(ctx context.Context, url, title string) error {
+	r.Prefix = "channel"
+	err := r.setDesired(ctx, DesiredState{
 		Command: "play",
-		Tittle:  videoTitle,
+		Title:   title,
 		URL:     url,
-	}
-
-	jsonData, err := json.Marshal(command)
+		Finite:  true,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal command: %w", err)
+		return err
 	}
+	r.recordPlay(ctx, "", url, title)
 
-	log.Printf("Sending command: %+v", jsonData)
-	return videoTitle, r.Client.Publish(ctx, remoteControlChannel, jsonData).Err()
+	return r.setPlayback(ctx, PlaybackState{Playing: true, Title: title})
 }
 
 func getYoutubeTitle(url string) (string, error) {
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Scheduled jobs are stored as JSON in the "schedule:jobs" hash by ID, and
+// "schedule:due" is a sorted set of their IDs scored by when they run next.
+// The scheduler claims a due job by pushing its score to the end of a lease,
+// so it fires once, then deletes one-off jobs and moves recurring jobs to
+// their next run.
+const (
+	scheduleJobsKey    = "schedule:jobs"
+	scheduleDueKey     = "schedule:due"
+	MaxScheduledJobs   = 100
+	ScheduleActionPlay = "play"
+	ScheduleActionStop = "stop"
+)
+
+type ScheduledJob struct {
+	ID string `json:"id"`
+	// ScheduleActionPlay or ScheduleActionStop
+	Action    string `json:"action"`
+	ChannelID string `json:"channel_id,omitempty"`
+	// Name of the channel when the job was added
+	ChannelName string `json:"channel_name,omitempty"`
+	// Title of the guide programme the job was scheduled for
+	Programme string `json:"programme,omitempty"`
+	// Cron expression of recurring jobs, empty for one-off jobs
+	Cron string `json:"cron,omitempty"`
+	// IANA name of the time zone the cron expression is in
+	Timezone string    `json:"timezone,omitempty"`
+	Next     time.Time `json:"next"`
+	UserID   string    `json:"user_id,omitempty"`
+	UserName string    `json:"user_name,omitempty"`
+	GuildID  string    `json:"guild_id,omitempty"`
+	// Set when a moderator scheduled the job, the DJ lock does not hold it
+	// back then
+	Moderator bool      `json:"moderator,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddScheduledJob stores a new job, its ID, requester and creation time are
+// filled in.
+func (r *RedisStore) AddScheduledJob(ctx context.Context, job *ScheduledJob) error {
+	count, err := r.Client.HLen(ctx, scheduleJobsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count scheduled jobs: %w", err)
+	}
+	if count >= MaxScheduledJobs {
+		return fmt.Errorf("schedule is full (%d jobs)", MaxScheduledJobs)
+	}
+
+	requester := RequesterFromContext(ctx)
+	job.ID = NewSessionID()
+	job.UserID = requester.UserID
+	job.UserName = requester.UserName
+	job.GuildID = requester.GuildID
+	job.CreatedAt = time.Now()
+	return r.SaveScheduledJob(ctx, job)
+}
+
+// SaveScheduledJob stores a job to run at job.Next.
+func (r *RedisStore) SaveScheduledJob(ctx context.Context, job *ScheduledJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled job: %w", err)
+	}
+
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, scheduleJobsKey, job.ID, data)
+		pipe.ZAdd(ctx, scheduleDueKey, &redis.Z{Score: float64(job.Next.Unix()), Member: job.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled job: %w", err)
+	}
+	return nil
+}
+
+// GetScheduledJobs returns every scheduled job, the next to run first.
+func (r *RedisStore) GetScheduledJobs(ctx context.Context) ([]ScheduledJob, error) {
+	values, err := r.Client.HGetAll(ctx, scheduleJobsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled jobs: %w", err)
+	}
+
+	jobs := make([]ScheduledJob, 0, len(values))
+	for _, data := range values {
+		var job ScheduledJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			log.Printf("Error unmarshaling scheduled job: %v", err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+	return jobs, nil
+}
+
+// GetScheduledJob returns a job by ID, or nil when there is none.
+func (r *RedisStore) GetScheduledJob(ctx context.Context, id string) (*ScheduledJob, error) {
+	data, err := r.Client.HGet(ctx, scheduleJobsKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled job: %w", err)
+	}
+
+	var job ScheduledJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scheduled job: %w", err)
+	}
+	return &job, nil
+}
+
+// DeleteScheduledJob removes a job so it never runs again.
+func (r *RedisStore) DeleteScheduledJob(ctx context.Context, id string) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, scheduleJobsKey, id)
+		pipe.ZRem(ctx, scheduleDueKey, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled job: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueJobs claims the jobs due at the given time and returns them. A
+// claim moves the job to the end of a lease in the due set instead of taking
+// it out, so a job claimed by a scheduler that dies before rescheduling or
+// deleting it comes due again once the lease is over. A job is only claimed
+// once, even with more than one scheduler running.
+func (r *RedisStore) ClaimDueJobs(ctx context.Context, at time.Time, lease time.Duration) ([]ScheduledJob, error) {
+	ids, err := r.Client.ZRangeByScore(ctx, scheduleDueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(at.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due jobs: %w", err)
+	}
+
+	var jobs []ScheduledJob
+	for _, id := range ids {
+		claimed := false
+		err := r.Client.Watch(ctx, func(tx *redis.Tx) error {
+			score, err := tx.ZScore(ctx, scheduleDueKey, id).Result()
+			if err == redis.Nil || (err == nil && score > float64(at.Unix())) {
+				// Deleted, rescheduled or claimed by someone else meanwhile
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZAdd(ctx, scheduleDueKey, &redis.Z{Score: float64(at.Add(lease).Unix()), Member: id})
+				return nil
+			})
+			claimed = err == nil
+			return err
+		}, scheduleDueKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return jobs, fmt.Errorf("failed to claim job: %w", err)
+		}
+		if !claimed {
+			continue
+		}
+
+		job, err := r.GetScheduledJob(ctx, id)
+		if err != nil {
+			return jobs, err
+		}
+		if job == nil {
+			// Left behind by a job deleted halfway
+			r.Client.ZRem(ctx, scheduleDueKey, id)
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
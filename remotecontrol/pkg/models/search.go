@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/search"
+)
+
+// The search index is built at import time inside the catalog version:
+//
+//	{catalog}:idx:tok:<token>   set of channel IDs whose name has the token
+//	{catalog}:idx:pre:<prefix>  set of channel IDs with a token starting with prefix
+//	{catalog}:idx:tri:<trigram> set of channel IDs with a token containing trigram
+//	{catalog}:idx:ntok          hash of channel ID to number of tokens in its name
+const (
+	exactWeight  = 1.0
+	prefixWeight = 0.7
+	fuzzyWeight  = 0.5
+	// Share of the trigrams of a query token a channel needs for a fuzzy match
+	minTrigramRatio = 0.5
+	// Bonus for names without extra words, "ESPN" ranks above "ESPN EXTRA"
+	tightnessWeight = 0.1
+
+	// Results returned by SearchChannelsByName
+	defaultSearchLimit = 100
+)
+
+type SearchResult struct {
+	Channels []TvChannel
+	Total    int
+	Page     int
+	PageSize int
+}
+
+// Pages returns the number of pages of the result.
+func (s *SearchResult) Pages() int {
+	if s.PageSize <= 0 || s.Total == 0 {
+		return 1
+	}
+	return (s.Total + s.PageSize - 1) / s.PageSize
+}
+
+// indexChannel adds the search index entries of a channel to the pipeline.
+func indexChannel(ctx context.Context, pipe redis.Pipeliner, prefix string, c TvChannel) {
+	tokens := search.Tokens(c.Name)
+	seen := make(map[string]bool)
+	add := func(kind, value string) {
+		key := fmt.Sprintf("%s:idx:%s:%s", prefix, kind, value)
+		if !seen[key] {
+			seen[key] = true
+			pipe.SAdd(ctx, key, c.ID)
+		}
+	}
+
+	for _, token := range tokens {
+		add("tok", token)
+		for _, p := range search.Prefixes(token) {
+			add("pre", p)
+		}
+		for _, t := range search.Trigrams(token) {
+			add("tri", t)
+		}
+	}
+	pipe.HSet(ctx, fmt.Sprintf("%s:idx:ntok", prefix), c.ID, len(tokens))
+}
+
+// SearchChannelsByName returns the channels that best match the search term,
+// most relevant first.
+func (r *RedisStore) SearchChannelsByName(ctx context.Context, searchTerm string) ([]TvChannel, error) {
+	result, err := r.SearchChannels(ctx, searchTerm, 0, defaultSearchLimit)
+	if err != nil {
+		return nil, err
+	}
+	return result.Channels, nil
+}
+
+// SearchChannels runs a ranked search over channel names and returns one page
+// of results, pages start at 0. Words may come in any order, accents and case
+// are ignored, partial words match by prefix and misspelled words by trigrams.
+// When some channels match every word of the query only those are returned.
+func (r *RedisStore) SearchChannels(ctx context.Context, query string, page, pageSize int) (*SearchResult, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{Page: page, PageSize: pageSize}
+
+	indexed, err := r.Client.Exists(ctx, fmt.Sprintf("%s:idx:ntok", prefix)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check search index: %w", err)
+	}
+	if indexed == 0 {
+		// Catalog imported before the index existed
+		channels, err := r.scanChannelsByName(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		result.Total = len(channels)
+		result.Channels = paginate(channels, page, pageSize)
+		return result, nil
+	}
+
+	queryTokens := search.Tokens(query)
+	if len(queryTokens) == 0 {
+		return result, nil
+	}
+
+	type tokenCmds struct {
+		exact, prefix *redis.StringSliceCmd
+		trigrams      []*redis.StringSliceCmd
+	}
+	cmds := make([]tokenCmds, len(queryTokens))
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, token := range queryTokens {
+			cmds[i].exact = pipe.SMembers(ctx, fmt.Sprintf("%s:idx:tok:%s", prefix, token))
+			cmds[i].prefix = pipe.SMembers(ctx, fmt.Sprintf("%s:idx:pre:%s", prefix, token))
+			for _, t := range search.Trigrams(token) {
+				cmds[i].trigrams = append(cmds[i].trigrams, pipe.SMembers(ctx, fmt.Sprintf("%s:idx:tri:%s", prefix, t)))
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to query search index: %w", err)
+	}
+
+	// Best match of every query token for every candidate channel
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+	for _, tc := range cmds {
+		best := make(map[string]float64)
+		raise := func(id string, score float64) {
+			if score > best[id] {
+				best[id] = score
+			}
+		}
+		for _, id := range tc.exact.Val() {
+			raise(id, exactWeight)
+		}
+		for _, id := range tc.prefix.Val() {
+			raise(id, prefixWeight)
+		}
+		if len(tc.trigrams) > 0 {
+			hits := make(map[string]int)
+			for _, cmd := range tc.trigrams {
+				for _, id := range cmd.Val() {
+					hits[id]++
+				}
+			}
+			for id, n := range hits {
+				ratio := float64(n) / float64(len(tc.trigrams))
+				if ratio >= minTrigramRatio {
+					raise(id, fuzzyWeight*ratio)
+				}
+			}
+		}
+
+		for id, score := range best {
+			scores[id] += score
+			matched[id]++
+		}
+	}
+	if len(scores) == 0 {
+		return result, nil
+	}
+
+	mostMatched := 0
+	for _, n := range matched {
+		mostMatched = max(mostMatched, n)
+	}
+	var ids []string
+	for id := range scores {
+		if matched[id] == mostMatched {
+			ids = append(ids, id)
+		}
+	}
+
+	tokenCounts, err := r.Client.HMGet(ctx, fmt.Sprintf("%s:idx:ntok", prefix), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query search index: %w", err)
+	}
+	for i, id := range ids {
+		scores[id] /= float64(len(queryTokens))
+		if v, ok := tokenCounts[i].(string); ok {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				scores[id] += tightnessWeight * float64(min(matched[id], n)) / float64(n)
+			}
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	result.Total = len(ids)
+
+	pageIDs := paginate(ids, page, pageSize)
+	hashes := make([]*redis.StringStringMapCmd, len(pageIDs))
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range pageIDs {
+			hashes[i] = pipe.HGetAll(ctx, fmt.Sprintf("%s:%s", prefix, id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channels: %w", err)
+	}
+	for _, cmd := range hashes {
+		if data := cmd.Val(); len(data) > 0 {
+			result.Channels = append(result.Channels, *channelFromHash(data))
+		}
+	}
+
+	return result, nil
+}
+
+func paginate[T any](items []T, page, pageSize int) []T {
+	if pageSize <= 0 {
+		return items
+	}
+	start := page * pageSize
+	if start < 0 || start >= len(items) {
+		return nil
+	}
+	end := min(start+pageSize, len(items))
+	return items[start:end]
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Interactive messages keep their state in Redis under "session:<kind>:<id>"
+// so buttons keep working across bot restarts until the session expires.
+const (
+	sessionPrefix = "session"
+	SessionTTL    = 15 * time.Minute
+)
+
+// ErrSessionExpired is returned when a session does not exist anymore.
+var ErrSessionExpired = errors.New("session expired")
+
+// SearchSession is the pagination state of a /search result message.
+type SearchSession struct {
+	ID          string `json:"id"`
+	Query       string `json:"query"`
+	Page        int    `json:"page"`
+	RequesterID string `json:"requester_id"`
+}
+
+// NewSessionID returns a random identifier short enough for component custom IDs.
+func NewSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// SaveSession stores value as JSON under the given kind and id, resetting its
+// expiration.
+func (r *RedisStore) SaveSession(ctx context.Context, kind, id string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	key := fmt.Sprintf("%s:%s:%s", sessionPrefix, kind, id)
+	if err := r.Client.Set(ctx, key, data, SessionTTL).Err(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// GetSession loads the session of the given kind and id into value.
+// It returns ErrSessionExpired when the session does not exist.
+func (r *RedisStore) GetSession(ctx context.Context, kind, id string, value interface{}) error {
+	key := fmt.Sprintf("%s:%s:%s", sessionPrefix, kind, id)
+	data, err := r.Client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrSessionExpired
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return nil
+}
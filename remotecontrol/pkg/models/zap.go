@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Channel IDs read at a time while looking for the next channel to zap to
+const zapBatchSize = 50
+
+// ErrNoChannel is returned when no channel matches the zapping filters.
+var ErrNoChannel = errors.New("no channel available")
+
+// AdjacentChannel returns the channel after the given ID when forward is set,
+// or the one before it otherwise, wrapping around at the ends of the catalog.
+// Channels the health prober marked as dead are skipped and, when group is
+// not empty, so are channels of other groups. The ID does not need to exist
+// anymore, an empty ID starts from the ends.
+func (r *RedisStore) AdjacentChannel(ctx context.Context, id string, forward bool, group string) (*TvChannel, error) {
+	prefix, err := r.catalogPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idsKey := fmt.Sprintf("%s:ids", prefix)
+
+	total, err := r.Client.ZCard(ctx, idsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count channels: %w", err)
+	}
+	dead, err := r.GetDeadChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the IDs in batches from the given one, wrapping around once
+	cursor := id
+	wrapped := false
+	for seen := int64(0); seen < total; {
+		batch, err := r.idsAfter(ctx, idsKey, cursor, forward)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			if wrapped {
+				break
+			}
+			wrapped = true
+			cursor = ""
+			continue
+		}
+		cursor = batch[len(batch)-1]
+
+		groups := make([]*redis.StringCmd, len(batch))
+		if group != "" {
+			_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i, candidate := range batch {
+					groups[i] = pipe.HGet(ctx, fmt.Sprintf("%s:%s", prefix, candidate), "group")
+				}
+				return nil
+			})
+			if err != nil && err != redis.Nil {
+				return nil, fmt.Errorf("failed to get channel groups: %w", err)
+			}
+		}
+
+		for i, candidate := range batch {
+			seen++
+			if candidate == id || dead[candidate] {
+				continue
+			}
+			if group != "" && !strings.EqualFold(groups[i].Val(), group) {
+				continue
+			}
+			n, err := strconv.ParseInt(candidate, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid channel id %q: %w", candidate, err)
+			}
+			return r.GetChannelByID(ctx, n)
+		}
+	}
+
+	return nil, ErrNoChannel
+}
+
+// idsAfter returns the next batch of channel IDs after the cursor, an empty
+// cursor starts from the first or last ID.
+func (r *RedisStore) idsAfter(ctx context.Context, idsKey, cursor string, forward bool) ([]string, error) {
+	var ids []string
+	var err error
+	if forward {
+		from := "-inf"
+		if cursor != "" {
+			from = "(" + cursor
+		}
+		ids, err = r.Client.ZRangeByScore(ctx, idsKey, &redis.ZRangeBy{
+			Min: from, Max: "+inf", Count: zapBatchSize,
+		}).Result()
+	} else {
+		from := "+inf"
+		if cursor != "" {
+			from = "(" + cursor
+		}
+		ids, err = r.Client.ZRevRangeByScore(ctx, idsKey, &redis.ZRangeBy{
+			Max: from, Min: "-inf", Count: zapBatchSize,
+		}).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel ids: %w", err)
+	}
+	return ids, nil
+}
+
+// GetLastChannelID returns the channel played before the current one, or an
+// empty string when there is none.
+func (r *RedisStore) GetLastChannelID(ctx context.Context) (string, error) {
+	key := fmt.Sprintf("%s:last", r.Prefix)
+	id, err := r.Client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get last channel: %w", err)
+	}
+	return id, nil
+}
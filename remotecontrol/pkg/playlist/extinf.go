@@ -0,0 +1,116 @@
+package playlist
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	extinfPrefix = "#EXTINF:"
+	extgrpPrefix = "#EXTGRP:"
+)
+
+// Attributes with a dedicated PlaylistItem field, everything else ends up in
+// PlaylistItem.Attributes.
+var knownAttributes = map[string]bool{
+	"tvg-id":      true,
+	"tvg-name":    true,
+	"tvg-logo":    true,
+	"group-title": true,
+}
+
+// parseExtinf parses an #EXTINF line in the extended M3U format:
+//
+//	#EXTINF:-1 tvg-id="globo.br" tvg-logo="http://..." group-title="BR",GLOBO, SP HD
+//
+// The duration is the first token, followed by optional key="value" attributes
+// and finally the display name after the first comma that is not inside quotes.
+// Channel names may contain commas, so everything after that comma is the name.
+func parseExtinf(line string) PlaylistItem {
+	item := PlaylistItem{Duration: -1}
+	rest := strings.TrimPrefix(line, extinfPrefix)
+
+	// Duration
+	end := strings.IndexAny(rest, " \t,")
+	if end < 0 {
+		end = len(rest)
+	}
+	if d, err := strconv.ParseFloat(strings.TrimSpace(rest[:end]), 64); err == nil {
+		item.Duration = d
+	}
+	rest = rest[end:]
+
+	attrs := make(map[string]string)
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			break
+		}
+		if rest[0] == ',' {
+			item.Name = strings.TrimSpace(rest[1:])
+			break
+		}
+
+		// Attribute key
+		end := strings.IndexAny(rest, "= \t,")
+		if end < 0 {
+			// Malformed line with no name, keep the key as a flag
+			attrs[strings.ToLower(rest)] = ""
+			break
+		}
+		key := strings.ToLower(rest[:end])
+		rest = rest[end:]
+		if rest[0] != '=' {
+			// Attribute without value
+			if key != "" {
+				attrs[key] = ""
+			}
+			continue
+		}
+		rest = rest[1:]
+
+		// Attribute value, quoted or bare
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			quote := rest[0]
+			closing := strings.IndexByte(rest[1:], quote)
+			if closing < 0 {
+				value = rest[1:]
+				rest = ""
+			} else {
+				value = rest[1 : closing+1]
+				rest = rest[closing+2:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t,")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+		if key != "" {
+			attrs[key] = strings.TrimSpace(value)
+		}
+	}
+
+	item.TvgID = attrs["tvg-id"]
+	item.TvgName = attrs["tvg-name"]
+	item.Logo = attrs["tvg-logo"]
+	item.Group = attrs["group-title"]
+	for key, value := range attrs {
+		if knownAttributes[key] {
+			continue
+		}
+		if item.Attributes == nil {
+			item.Attributes = make(map[string]string)
+		}
+		item.Attributes[key] = value
+	}
+
+	if item.Name == "" {
+		item.Name = item.TvgName
+	}
+
+	return item
+}
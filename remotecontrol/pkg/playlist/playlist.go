@@ -3,74 +3,144 @@ package playlist
 import (
 	"bufio"
 	"context"
-	"io"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
 )
 
 const (
-	cacheDir  = "/data"
-	cacheFile = "playlist.m3u"
+	cacheDir = "/data"
 )
 
+// importMu serializes channel database rebuilds between the startup update
+// and the background refresher.
+var importMu sync.Mutex
+
 type Playlist struct {
 	Items []PlaylistItem
 }
 
 type PlaylistItem struct {
-	Name string
-	URL  string
+	Name       string
+	URL        string
+	TvgID      string
+	TvgName    string
+	Logo       string
+	Group      string
+	Duration   float64
+	Attributes map[string]string
+	Source     string
 }
 
+// UpdatePlaylist fetches every playlist source and rebuilds the channel
+// database. It runs at startup, so it is fatal when no source can be loaded,
+// a source that fails to download falls back to its cached copy.
 func UpdatePlaylist(ctx context.Context) {
-	playlistUrl, ok := os.LookupEnv("PLAYLIST_URL")
-	if !ok {
-		log.Fatal("PLAYLIST_URL environment variable is required")
+	sources, err := LoadSources()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Download playlist
-	filePath := filepath.Join(cacheDir, cacheFile)
-	file, err := downloadPlaylist(playlistUrl, filePath)
-	if err != nil {
-		log.Fatal("Failed to download playlist:", err)
+	// Download playlists
+	for i := range sources {
+		src := &sources[i]
+		if _, err := src.Fetch(ctx); err != nil {
+			log.Printf("Failed to fetch playlist source %s, using cached copy: %v", src.Name, err)
+		}
 	}
 
-	// Parse playlist
-	playlist, err := parsePlaylist(file)
-	if err != nil {
-		log.Fatal("Failed to parse playlist:", err)
+	if err := importSources(ctx, sources); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importSources parses the playlist of every source, merges them and
+// replaces the channels stored in Redis with the result. Only once it
+// succeeded is the fetched content of the sources recorded as imported.
+func importSources(ctx context.Context, sources []Source) error {
+	importMu.Lock()
+	defer importMu.Unlock()
+
+	// Parse playlists
+	playlists := make(map[string]*Playlist, len(sources))
+	for i := range sources {
+		src := &sources[i]
+		playlist, err := parsePlaylist(src.FilePath())
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Printf("Skipping playlist source %s: no playlist downloaded yet", src.Name)
+				continue
+			}
+			return fmt.Errorf("failed to parse playlist %s: %w", src.Name, err)
+		}
+		log.Printf("Playlist %s parsed successfully: %d items", src.Name, len(playlist.Items))
+		playlists[src.Name] = playlist
 	}
-	log.Printf("Playlist parsed successfully: %d items", len(playlist.Items))
+	if len(playlists) == 0 {
+		return fmt.Errorf("no playlist available from any source")
+	}
+	items := mergeSources(sources, playlists)
 
 	s, err := models.NewAuthenticatedRedisClient(ctx)
 	if err != nil {
-		log.Fatal("Failed to create Redis client:", err)
+		return fmt.Errorf("failed to create Redis client: %w", err)
 	}
 	s.Prefix = "channel"
-	// Reset the channels in Redis
-	err = s.DeleteAll(ctx)
+	channels := make([]models.TvChannel, 0, len(items))
+	for _, item := range items {
+		channels = append(channels, models.TvChannel{
+			Name:       item.Name,
+			URL:        item.URL,
+			TvgID:      item.TvgID,
+			TvgName:    item.TvgName,
+			Logo:       item.Logo,
+			Group:      item.Group,
+			Duration:   item.Duration,
+			Attributes: item.Attributes,
+			Source:     item.Source,
+		})
+	}
+
+	// Keep the IDs people already know across refreshes
+	err = s.AllocateChannelIDs(ctx, channels)
 	if err != nil {
-		log.Fatal("Failed to reset channels in Redis:", err)
+		return fmt.Errorf("failed to allocate channel IDs: %w", err)
 	}
 
-	for i, item := range playlist.Items {
-		if item.Name == "" || item.URL == "" {
-			log.Printf("Skipping invalid item %d: missing name or URL", i)
-			continue
-		}
+	// Write the new catalog next to the active one and flip to it at the end,
+	// readers keep using the previous catalog while the import runs
+	catalog, err := s.BeginImport(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start catalog import: %w", err)
+	}
+	for _, channel := range channels {
 		// Save item to Redis
-		s.Save(ctx, models.TvChannel{
-			ID:   strconv.Itoa(i),
-			Name: item.Name,
-			URL:  item.URL,
-		})
+		if err := catalog.Save(ctx, channel); err != nil {
+			if abortErr := catalog.AbortImport(ctx); abortErr != nil {
+				log.Printf("Failed to abort catalog import: %v", abortErr)
+			}
+			return fmt.Errorf("failed to save channel %s: %w", channel.Name, err)
+		}
 	}
+	if err := catalog.CommitImport(ctx); err != nil {
+		return fmt.Errorf("failed to commit catalog import: %w", err)
+	}
+	log.Printf("Channel database updated: %d channels", len(channels))
+
+	// Dead marks of old streams would hide the new ones until the next probe
+	if err := s.PruneDeadChannels(ctx, channels); err != nil {
+		log.Printf("Failed to prune dead channels: %v", err)
+	}
+
+	for i := range sources {
+		sources[i].commitFetch()
+	}
+
+	return nil
 }
 
 func parsePlaylist(filePath string) (*Playlist, error) {
@@ -85,13 +155,15 @@ func parsePlaylist(filePath string) (*Playlist, error) {
 	var currentItem PlaylistItem
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		if line == "" || line == "#EXTM3U" {
+		if line == "" || strings.HasPrefix(line, "#EXTM3U") {
 			continue
 		}
-		if strings.HasPrefix(line, "#EXTINF:") {
-			parts := strings.Split(line, ",")
-			if len(parts) > 1 {
-				currentItem.Name = parts[1]
+		if strings.HasPrefix(line, extinfPrefix) {
+			currentItem = parseExtinf(line)
+		} else if strings.HasPrefix(line, extgrpPrefix) {
+			// #EXTGRP only applies when the EXTINF line has no group-title
+			if currentItem.Group == "" {
+				currentItem.Group = strings.TrimSpace(strings.TrimPrefix(line, extgrpPrefix))
 			}
 		} else if !strings.HasPrefix(line, "#") {
 			currentItem.URL = line
@@ -115,36 +187,3 @@ func ensureDir(dir string) error {
 	log.Printf("Directory already exists: %s", dir)
 	return nil
 }
-
-func downloadPlaylist(url, filePath string) (string, error) {
-	if err := ensureDir(cacheDir); err != nil {
-		log.Fatal("Failed to create cache directory:", err)
-	}
-
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Printf("Cache file not found, downloading from PLAYLIST_URL environment variable")
-
-		resp, err := http.Get(url)
-		if err != nil {
-			log.Fatal("Failed to download playlist:", err)
-		}
-		defer resp.Body.Close()
-		log.Printf("Successfully downloaded playlist")
-
-		out, err := os.Create(filePath)
-		if err != nil {
-			log.Fatal("Failed to create cache file:", err)
-		}
-		defer out.Close()
-
-		bytes, err := io.Copy(out, resp.Body)
-		if err != nil {
-			log.Fatal("Failed to write playlist to cache:", err)
-		}
-		log.Printf("Successfully wrote %d bytes to cache file", bytes)
-	} else {
-		log.Printf("Using existing cache file: %s", filePath)
-	}
-
-	return filePath, nil
-}
@@ -0,0 +1,208 @@
+package playlist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultRefreshInterval = 6 * time.Hour
+	downloadTimeout        = 2 * time.Minute
+)
+
+// cacheMeta holds the validators of the cached playlist, stored next to the
+// cache file so conditional requests keep working after a restart.
+type cacheMeta struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	SHA256       string `json:"sha256"`
+}
+
+// Refresher periodically fetches the playlist sources and rebuilds the
+// channel database when any of them changes.
+type Refresher struct {
+	Sources  []Source
+	Interval time.Duration
+}
+
+// NewRefresher creates a Refresher from the environment. The sources come
+// from LoadSources and PLAYLIST_REFRESH_INTERVAL (a Go duration, e.g. "6h")
+// sets how often they are checked, "0" disables the refresher. Without any
+// source the refresher is disabled too, the channels already in Redis stay.
+func NewRefresher() (*Refresher, error) {
+	if !sourcesConfigured() {
+		return &Refresher{}, nil
+	}
+	sources, err := LoadSources()
+	if err != nil {
+		return nil, err
+	}
+
+	interval := defaultRefreshInterval
+	if v, ok := os.LookupEnv("PLAYLIST_REFRESH_INTERVAL"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PLAYLIST_REFRESH_INTERVAL: %w", err)
+		}
+		interval = parsed
+	}
+
+	return &Refresher{
+		Sources:  sources,
+		Interval: interval,
+	}, nil
+}
+
+// Run checks the playlist every Interval until the context is cancelled.
+func (f *Refresher) Run(ctx context.Context) {
+	if f.Interval <= 0 {
+		log.Println("Playlist refresher disabled")
+		return
+	}
+	log.Printf("Playlist refresher running every %s", f.Interval)
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.Refresh(ctx); err != nil {
+				log.Printf("Playlist refresh failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Refresh fetches every source and rebuilds the channel database only when
+// the content of at least one of them changed. A source that fails to
+// download keeps its cached playlist.
+func (f *Refresher) Refresh(ctx context.Context) error {
+	changed := false
+	for i := range f.Sources {
+		src := &f.Sources[i]
+		sourceChanged, err := src.Fetch(ctx)
+		if err != nil {
+			log.Printf("Failed to fetch playlist source %s: %v", src.Name, err)
+			continue
+		}
+		changed = changed || sourceChanged
+	}
+	if !changed {
+		log.Println("Playlists unchanged, skipping channel database update")
+		return nil
+	}
+	return importSources(ctx, f.Sources)
+}
+
+// fetchPlaylist downloads url into filePath using a conditional request based
+// on the validators of the cached copy. It reports whether the content changed.
+// The new content is written to a temporary file and renamed over the cache,
+// so a failed download never replaces a good playlist. The validators of
+// changed content are returned instead of written, they are only saved once
+// the content was imported so a failed import is retried on the next refresh.
+func fetchPlaylist(ctx context.Context, url, filePath string) (bool, *cacheMeta, error) {
+	if err := ensureDir(filepath.Dir(filePath)); err != nil {
+		return false, nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	meta := readCacheMeta(filePath + ".meta")
+	_, statErr := os.Stat(filePath)
+	cached := statErr == nil
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if cached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to download playlist: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached {
+		log.Printf("Playlist not modified since last download")
+		return false, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("failed to download playlist: unexpected status %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	bytes, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to write playlist to cache: %w", err)
+	}
+	log.Printf("Successfully downloaded playlist: %d bytes", bytes)
+
+	newMeta := cacheMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+	}
+	changed := !cached || newMeta.SHA256 != meta.SHA256
+
+	if !changed {
+		// Same content as imported last, only the validators may be new
+		writeCacheMeta(filePath+".meta", newMeta)
+		return false, nil, nil
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return false, nil, fmt.Errorf("failed to replace cache file: %w", err)
+	}
+	return true, &newMeta, nil
+}
+
+func readCacheMeta(metaPath string) cacheMeta {
+	var meta cacheMeta
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		log.Printf("Ignoring invalid playlist cache metadata: %v", err)
+	}
+	return meta
+}
+
+func writeCacheMeta(metaPath string, meta cacheMeta) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		log.Printf("Failed to write playlist cache metadata: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package playlist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// Source is one M3U provider. Either URL or Path must be set, URL sources are
+// downloaded into a per-source cache file under cacheDir. Sources with a lower
+// Priority win when the same channel appears in more than one source.
+// Include and Exclude are case-insensitive regular expressions matched against
+// the channel name and group.
+type Source struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Priority int      `json:"priority"`
+	Include  []string `json:"include,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	// Validators of fetched content not imported yet
+	pending *cacheMeta
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// sourcesConfigured reports whether PLAYLIST_SOURCES_FILE or PLAYLIST_URL is
+// set, LoadSources fails otherwise.
+func sourcesConfigured() bool {
+	return os.Getenv("PLAYLIST_SOURCES_FILE") != "" || os.Getenv("PLAYLIST_URL") != ""
+}
+
+// LoadSources reads the playlist sources from the JSON file pointed to by
+// PLAYLIST_SOURCES_FILE. When it is not set, PLAYLIST_URL is used as a single
+// source named "default".
+func LoadSources() ([]Source, error) {
+	var sources []Source
+
+	if sourcesFile, ok := os.LookupEnv("PLAYLIST_SOURCES_FILE"); ok && sourcesFile != "" {
+		data, err := os.ReadFile(sourcesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read playlist sources: %w", err)
+		}
+		if err := json.Unmarshal(data, &sources); err != nil {
+			return nil, fmt.Errorf("failed to parse playlist sources: %w", err)
+		}
+	} else if playlistUrl, ok := os.LookupEnv("PLAYLIST_URL"); ok && playlistUrl != "" {
+		sources = append(sources, Source{Name: "default", URL: playlistUrl})
+	} else {
+		return nil, fmt.Errorf("PLAYLIST_SOURCES_FILE or PLAYLIST_URL environment variable is required")
+	}
+
+	names := make(map[string]bool, len(sources))
+	for i := range sources {
+		src := &sources[i]
+		if src.Name == "" {
+			return nil, fmt.Errorf("playlist source %d has no name", i)
+		}
+		if names[src.Name] {
+			return nil, fmt.Errorf("duplicate playlist source name: %s", src.Name)
+		}
+		names[src.Name] = true
+		if (src.URL == "") == (src.Path == "") {
+			return nil, fmt.Errorf("playlist source %s must have either url or path", src.Name)
+		}
+
+		for _, expr := range src.Include {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid include filter for source %s: %w", src.Name, err)
+			}
+			src.include = append(src.include, re)
+		}
+		for _, expr := range src.Exclude {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude filter for source %s: %w", src.Name, err)
+			}
+			src.exclude = append(src.exclude, re)
+		}
+	}
+
+	// Highest priority first, keeping the file order for ties
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Priority < sources[j].Priority
+	})
+
+	return sources, nil
+}
+
+// FilePath returns the playlist file of the source, the cache file for URL
+// sources or the configured path for local ones.
+func (src *Source) FilePath() string {
+	if src.Path != "" {
+		return src.Path
+	}
+	return src.cachePath()
+}
+
+func (src *Source) cachePath() string {
+	name := unsafeFileChars.ReplaceAllString(src.Name, "_")
+	return filepath.Join(cacheDir, fmt.Sprintf("playlist-%s.m3u", name))
+}
+
+// Fetch updates the playlist file of the source and reports whether its
+// content changed. URL sources are downloaded with a conditional request,
+// local files are compared against the hash of the last import. What changed
+// is only recorded as imported by commitFetch, after a successful import.
+func (src *Source) Fetch(ctx context.Context) (bool, error) {
+	if src.URL != "" {
+		changed, meta, err := fetchPlaylist(ctx, src.URL, src.cachePath())
+		if changed {
+			src.pending = meta
+		}
+		return changed, err
+	}
+
+	file, err := os.Open(src.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open playlist: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return false, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	metaPath := src.cachePath() + ".meta"
+	meta := readCacheMeta(metaPath)
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if sum == meta.SHA256 {
+		return false, nil
+	}
+	if err := ensureDir(cacheDir); err != nil {
+		return false, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	src.pending = &cacheMeta{SHA256: sum}
+	return true, nil
+}
+
+// commitFetch records the content fetched last as imported, so the next
+// Fetch compares against it.
+func (src *Source) commitFetch() {
+	if src.pending == nil {
+		return
+	}
+	writeCacheMeta(src.cachePath()+".meta", *src.pending)
+	src.pending = nil
+}
+
+// accepts reports whether the item passes the include and exclude filters.
+func (src *Source) accepts(item PlaylistItem) bool {
+	matches := func(re *regexp.Regexp) bool {
+		return re.MatchString(item.Name) || re.MatchString(item.Group)
+	}
+
+	if len(src.include) > 0 {
+		included := false
+		for _, re := range src.include {
+			if matches(re) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, re := range src.exclude {
+		if matches(re) {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupeKey identifies the same channel across sources: the tvg-id when the
+// playlist has one, otherwise the normalized channel name.
+func dedupeKey(item PlaylistItem) string {
+	if item.TvgID != "" {
+		return "tvg:" + strings.ToLower(item.TvgID)
+	}
+	return "name:" + models.NormalizeName(item.Name)
+}
+
+// mergeSources combines the playlists of every source, in priority order,
+// into a single list. A channel already provided by a higher priority source
+// is dropped, duplicates inside the same source are kept.
+func mergeSources(sources []Source, playlists map[string]*Playlist) []PlaylistItem {
+	var merged []PlaylistItem
+	owner := make(map[string]string)
+
+	for i := range sources {
+		src := &sources[i]
+		playlist, ok := playlists[src.Name]
+		if !ok {
+			continue
+		}
+
+		filtered, duplicated := 0, 0
+		for _, item := range playlist.Items {
+			if item.Name == "" || item.URL == "" {
+				log.Printf("Skipping invalid item from source %s: missing name or URL", src.Name)
+				continue
+			}
+			if !src.accepts(item) {
+				filtered++
+				continue
+			}
+			key := dedupeKey(item)
+			if name, ok := owner[key]; ok && name != src.Name {
+				duplicated++
+				continue
+			}
+			owner[key] = src.Name
+
+			item.Source = src.Name
+			merged = append(merged, item)
+		}
+		log.Printf("Source %s: %d items, %d filtered, %d already in other sources",
+			src.Name, len(playlist.Items), filtered, duplicated)
+	}
+
+	return merged
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"log"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+// Run advances the play queue every time the streamer reports the queue item
+// playing now ended or failed, until the context is cancelled.
+func Run(ctx context.Context) {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v", err)
+		return
+	}
+	r.Prefix = "channel"
+
+	pubsub := r.SubscribeEvents(ctx)
+	defer pubsub.Close()
+	events := pubsub.Channel()
+
+	for {
+		select {
+		case msg := <-events:
+			event, err := models.ParseEvent(msg)
+			if err != nil {
+				log.Printf("Error parsing streamer event: %v", err)
+				continue
+			}
+			if event.Event != models.EventEnded && event.Event != models.EventError {
+				continue
+			}
+			advance(ctx, r, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func advance(ctx context.Context, r *models.RedisStore, event *models.StreamerEvent) {
+	current, err := r.GetQueueCurrent(ctx)
+	if err != nil {
+		log.Printf("Error getting current queue item: %v", err)
+		return
+	}
+	// Not playing from the queue, or an older item reporting late
+	if current == nil || current.URL != event.URL {
+		return
+	}
+
+	if event.Event == models.EventError {
+		log.Printf("Queue item %s failed: %s", current.Title, event.Error)
+	}
+	next, err := r.PlayNext(ctx)
+	if err != nil {
+		log.Printf("Error playing next queue item: %v", err)
+		return
+	}
+	if next == nil {
+		log.Println("Queue finished")
+		return
+	}
+	log.Printf("Queue advanced to %s", next.Title)
+}
@@ -0,0 +1,427 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const (
+	defaultMinBackoff     = 5 * time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	defaultCommandTimeout = 45 * time.Second
+	defaultWatchdog       = 2 * time.Minute
+
+	defaultFailoverAfterFailures = 2
+	defaultFailoverMaxSwitches   = 3
+
+	// How often the desired state is checked when nothing happens
+	checkInterval = 5 * time.Second
+	// The streamer state is unknown until its first heartbeat, nothing is
+	// sent before one arrives or this long after starting
+	heartbeatWait = time.Minute
+)
+
+// FailoverPolicy decides when a failing channel is replaced by one of its
+// alternates, see models.GetAlternates.
+type FailoverPolicy struct {
+	Enabled bool
+	// Failed attempts of a channel before switching to an alternate
+	AfterFailures int
+	// Alternates tried before settling for retrying the last one
+	MaxSwitches int
+	// Whether alternates the health prober marked as dead may be tried
+	IncludeDead bool
+}
+
+// Reconciler sends stream commands until what the streamer reports matches
+// the desired state. A stream that fails, dies or gets no answer within
+// CommandTimeout is tried again after a backoff doubling from MinBackoff up
+// to MaxBackoff, and channels that keep failing fail over to their
+// alternates. No event at all from the streamer for Watchdog counts as a
+// failure too.
+type Reconciler struct {
+	MinBackoff     time.Duration
+	MaxBackoff     time.Duration
+	CommandTimeout time.Duration
+	Watchdog       time.Duration
+	Failover       FailoverPolicy
+
+	r         *models.RedisStore
+	startedAt time.Time
+
+	// What the streamer reported last
+	seen     bool
+	playing  bool
+	url      string
+	lastSeen time.Time
+	silent   bool
+
+	// Progress towards the desired state, reset by every new generation
+	desired     *models.DesiredState
+	pending     bool
+	sentAt      time.Time
+	failures    int
+	nextAttempt time.Time
+	finished    bool
+	lastError   string
+	exhausted   bool
+	// The desired state changed while running, its commands are sent even
+	// if the streamer seems to match it already
+	requested bool
+}
+
+// NewReconciler creates a Reconciler from the environment:
+// RECONCILE_MIN_BACKOFF, RECONCILE_MAX_BACKOFF, RECONCILE_COMMAND_TIMEOUT and
+// RECONCILE_WATCHDOG (Go durations), FAILOVER_ENABLED, FAILOVER_AFTER_FAILURES,
+// FAILOVER_MAX_SWITCHES and FAILOVER_INCLUDE_DEAD.
+func NewReconciler() (*Reconciler, error) {
+	rc := &Reconciler{
+		MinBackoff:     defaultMinBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		CommandTimeout: defaultCommandTimeout,
+		Watchdog:       defaultWatchdog,
+		Failover: FailoverPolicy{
+			Enabled:       true,
+			AfterFailures: defaultFailoverAfterFailures,
+			MaxSwitches:   defaultFailoverMaxSwitches,
+		},
+	}
+
+	durations := map[string]*time.Duration{
+		"RECONCILE_MIN_BACKOFF":     &rc.MinBackoff,
+		"RECONCILE_MAX_BACKOFF":     &rc.MaxBackoff,
+		"RECONCILE_COMMAND_TIMEOUT": &rc.CommandTimeout,
+		"RECONCILE_WATCHDOG":        &rc.Watchdog,
+	}
+	for env, target := range durations {
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", env, v)
+			}
+			*target = parsed
+		}
+	}
+	bools := map[string]*bool{
+		"FAILOVER_ENABLED":      &rc.Failover.Enabled,
+		"FAILOVER_INCLUDE_DEAD": &rc.Failover.IncludeDead,
+	}
+	for env, target := range bools {
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %q", env, v)
+			}
+			*target = parsed
+		}
+	}
+	ints := map[string]*int{
+		"FAILOVER_AFTER_FAILURES": &rc.Failover.AfterFailures,
+		"FAILOVER_MAX_SWITCHES":   &rc.Failover.MaxSwitches,
+	}
+	for env, target := range ints {
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("invalid %s: %q", env, v)
+			}
+			*target = parsed
+		}
+	}
+	if rc.MaxBackoff < rc.MinBackoff {
+		rc.MaxBackoff = rc.MinBackoff
+	}
+	return rc, nil
+}
+
+// Run reconciles the streamer with the desired state on every streamer event
+// and desired state change, until the context is cancelled.
+func (rc *Reconciler) Run(ctx context.Context) {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v", err)
+		return
+	}
+	r.Prefix = "channel"
+	rc.r = r
+	rc.startedAt = time.Now()
+
+	events := r.SubscribeEvents(ctx)
+	defer events.Close()
+	updates := r.SubscribeDesired(ctx)
+	defer updates.Close()
+	eventsCh := events.Channel()
+	updatesCh := updates.Channel()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-eventsCh:
+			event, err := models.ParseEvent(msg)
+			if err != nil {
+				log.Printf("Error parsing streamer event: %v", err)
+				continue
+			}
+			rc.observe(event)
+		case <-updatesCh:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		rc.reconcile(ctx)
+	}
+}
+
+// observe updates what is known about the streamer from one of its events.
+func (rc *Reconciler) observe(event *models.StreamerEvent) {
+	rc.lastSeen = time.Now()
+	rc.silent = false
+
+	switch event.Event {
+	case models.EventHeartbeat:
+		rc.seen = true
+		rc.playing = event.State == "playing"
+		rc.url = event.URL
+		// The streamer replays the desired state by itself when it boots
+		if event.Boot && rc.desired != nil && rc.desired.Playing() {
+			rc.pending = true
+			rc.sentAt = time.Now()
+		}
+	case models.EventAck:
+		if event.Command == "stop" {
+			rc.playing = false
+		}
+	case models.EventStarted:
+		rc.seen = true
+		rc.playing = true
+		rc.url = event.URL
+		if rc.isDesired(event) {
+			rc.pending = false
+			rc.failures = 0
+		}
+	case models.EventEnded:
+		rc.playing = false
+		if !rc.isDesired(event) {
+			return
+		}
+		rc.pending = false
+		if rc.desired.Finite {
+			rc.finished = true
+			return
+		}
+		rc.fail("the stream died")
+	case models.EventError:
+		if event.Command == "stop" {
+			return
+		}
+		if event.Command == "play" {
+			rc.playing = false
+		}
+		if rc.isDesired(event) {
+			rc.pending = false
+			rc.fail(event.Error)
+		}
+	}
+}
+
+func (rc *Reconciler) isDesired(event *models.StreamerEvent) bool {
+	return rc.desired != nil && rc.desired.Playing() && event.URL == rc.desired.URL
+}
+
+// fail schedules the next attempt to play the desired state.
+func (rc *Reconciler) fail(reason string) {
+	rc.failures++
+	rc.lastError = reason
+	backoff := rc.MinBackoff
+	for n := 1; n < rc.failures && backoff < rc.MaxBackoff; n++ {
+		backoff *= 2
+	}
+	if backoff > rc.MaxBackoff {
+		backoff = rc.MaxBackoff
+	}
+	rc.nextAttempt = time.Now().Add(backoff)
+	log.Printf("Streamer failed to play %s (%s), trying again in %s", rc.desired.Title, reason, backoff)
+}
+
+// reconcile sends the commands, if any, that bring the streamer closer to
+// the desired state.
+func (rc *Reconciler) reconcile(ctx context.Context) {
+	desired, err := rc.r.GetDesired(ctx)
+	if err != nil {
+		log.Printf("Error getting desired state: %v", err)
+		return
+	}
+	if rc.desired == nil || desired.Generation != rc.desired.Generation {
+		rc.requested = rc.desired != nil
+		rc.pending = false
+		rc.failures = 0
+		rc.nextAttempt = time.Time{}
+		rc.finished = false
+		rc.exhausted = false
+	}
+	rc.desired = desired
+
+	if !rc.seen && time.Since(rc.startedAt) < heartbeatWait {
+		return
+	}
+	if rc.pending {
+		if time.Since(rc.sentAt) < rc.CommandTimeout {
+			return
+		}
+		rc.pending = false
+		rc.fail("no answer from the streamer")
+	}
+	if desired.Playing() && rc.seen && !rc.silent && time.Since(rc.lastSeen) > rc.Watchdog {
+		rc.silent = true
+		rc.playing = false
+		rc.fail("no heartbeat from the streamer")
+	}
+
+	// Commands carry the ID of the request that set the desired state, so
+	// whoever made it can follow the outcome
+	ctx = models.WithCommandID(ctx, desired.ID)
+
+	if desired.Dirty {
+		if err := rc.r.SendCommand(ctx, models.ChannelCommand{Command: "restart"}); err != nil {
+			log.Printf("Error sending restart command: %v", err)
+			return
+		}
+		if err := rc.r.ClearDesiredDirty(ctx, desired.Generation); err != nil {
+			log.Printf("Error clearing desired state: %v", err)
+		}
+		rc.playing = false
+		rc.pending = desired.Playing()
+		rc.sentAt = time.Now()
+		rc.requested = false
+		return
+	}
+
+	if !desired.Playing() {
+		if rc.playing || rc.requested {
+			if err := rc.r.SendCommand(ctx, models.ChannelCommand{Command: "stop"}); err != nil {
+				log.Printf("Error sending stop command: %v", err)
+				return
+			}
+			rc.playing = false
+			rc.requested = false
+		}
+		return
+	}
+
+	if rc.playing && rc.url == desired.URL && !rc.requested {
+		return
+	}
+	if rc.finished {
+		// The record says stop too, or the streamer would play the media
+		// again from the start when it boots
+		if err := rc.r.FinishDesired(ctx, desired.Generation); err != nil {
+			log.Printf("Error stopping finished media: %v", err)
+			return
+		}
+		// Nothing is left to stop, the state that comes next is not a new
+		// request
+		rc.desired = nil
+		return
+	}
+	if rc.failures >= rc.Failover.AfterFailures && rc.failover(ctx, desired) {
+		// The new desired state wakes the loop up again
+		return
+	}
+	if time.Now().Before(rc.nextAttempt) {
+		return
+	}
+
+	if rc.playing {
+		if err := rc.r.SendCommand(ctx, models.ChannelCommand{Command: "stop"}); err != nil {
+			log.Printf("Error sending stop command: %v", err)
+			return
+		}
+		rc.playing = false
+	}
+	command := models.ChannelCommand{
+		Command: "play",
+		Tittle:  desired.Title,
+		URL:     desired.URL,
+		Options: desired.Options,
+	}
+	if err := rc.r.SendCommand(ctx, command); err != nil {
+		log.Printf("Error sending play command: %v", err)
+		return
+	}
+	rc.pending = true
+	rc.sentAt = time.Now()
+	rc.requested = false
+}
+
+// failover switches the desired state to the best alternate of the failing
+// channel not tried yet. It reports whether it did.
+func (rc *Reconciler) failover(ctx context.Context, desired *models.DesiredState) bool {
+	if !rc.Failover.Enabled || desired.ChannelID == "" || rc.exhausted {
+		return false
+	}
+	if len(desired.Tried) >= rc.Failover.MaxSwitches {
+		rc.giveUp(ctx, desired)
+		return false
+	}
+
+	id, err := strconv.ParseInt(desired.ChannelID, 10, 64)
+	if err != nil {
+		return false
+	}
+	channel, err := rc.r.GetChannelByID(ctx, id)
+	if err != nil {
+		log.Printf("Error getting failing channel: %v", err)
+		rc.giveUp(ctx, desired)
+		return false
+	}
+	alternates, err := rc.r.GetAlternates(ctx, channel)
+	if err != nil {
+		log.Printf("Error getting alternate channels: %v", err)
+		return false
+	}
+
+	tried := map[string]bool{desired.ChannelID: true}
+	for _, id := range desired.Tried {
+		tried[id] = true
+	}
+	for _, alternate := range alternates {
+		if tried[alternate.Channel.ID] || (alternate.Health.Status == models.HealthDead && !rc.Failover.IncludeDead) {
+			continue
+		}
+		err := rc.r.Failover(ctx, desired, alternate.Channel)
+		if errors.Is(err, models.ErrDesiredChanged) {
+			// The new desired state wakes the loop up again
+			return true
+		}
+		if err != nil {
+			log.Printf("Error failing over: %v", err)
+			return false
+		}
+		log.Printf("Failing over from %s to %s", desired.URL, alternate.Channel.URL)
+		rc.notify(ctx, fmt.Sprintf("%s failed (%s), switching to %s", desired.Title, rc.lastError, alternate.Channel.Name))
+		return true
+	}
+	rc.giveUp(ctx, desired)
+	return false
+}
+
+// giveUp stops looking for alternates until the desired state changes.
+func (rc *Reconciler) giveUp(ctx context.Context, desired *models.DesiredState) {
+	rc.exhausted = true
+	rc.notify(ctx, fmt.Sprintf("%s keeps failing (%s) and there is no other source to try, still retrying it", desired.Title, rc.lastError))
+}
+
+func (rc *Reconciler) notify(ctx context.Context, text string) {
+	if err := rc.r.PublishNotice(ctx, text); err != nil {
+		log.Printf("Error publishing notice: %v", err)
+	}
+}
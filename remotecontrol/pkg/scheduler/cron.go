@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nothing this far ahead matches, the expression asks for a date that never
+// comes like February 30
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// Cron is a standard five field cron expression: minute, hour, day of month,
+// month and day of week. Fields take "*", numbers, ranges, lists and steps
+// ("*/15", "1-5", "0,6"), days of the week go from 0 (Sunday) to 7 (Sunday
+// again).
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// When both days are restricted either may match, like in crontab
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	min, max int
+	target   *uint64
+}
+
+// ParseCron parses a five field cron expression.
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	c := &Cron{}
+	specs := []cronField{
+		{0, 59, &c.minute},
+		{0, 23, &c.hour},
+		{1, 31, &c.dom},
+		{1, 12, &c.month},
+		{0, 7, &c.dow},
+	}
+	for n, spec := range specs {
+		bits, err := parseCronField(fields[n], spec.min, spec.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %w", fields[n], err)
+		}
+		*spec.target = bits
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = parsed
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				// "5/15" runs from 5 to the end
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", rangePart, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after the given one the expression matches, in
+// the location of after. It returns the zero time when nothing matches.
+func (c *Cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxCronSearch)
+
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case c.month&(1<<uint(month)) == 0:
+			t = later(t, time.Date(year, month+1, 1, 0, 0, 0, 0, loc))
+		case !c.dayMatches(t):
+			t = later(t, time.Date(year, month, day+1, 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = later(t, time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc))
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// later returns next, or a minute after t when daylight saving time turned
+// next into a time that is not after t.
+func later(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Minute)
+}
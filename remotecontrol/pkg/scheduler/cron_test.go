@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		zone  string
+		after string
+		// Empty when the expression never matches
+		want string
+	}{
+		{"step", "*/15 * * * *", "UTC", "2024-01-01T10:07:00Z", "2024-01-01T10:15:00Z"},
+		{"step from exact match", "*/15 * * * *", "UTC", "2024-01-01T10:15:00Z", "2024-01-01T10:30:00Z"},
+		{"range with step", "0 9-17/4 * * *", "UTC", "2024-01-01T10:00:00Z", "2024-01-01T13:00:00Z"},
+		{"value with step", "5/20 * * * *", "UTC", "2024-01-01T10:30:00Z", "2024-01-01T10:45:00Z"},
+		{"list of weekdays", "30 8 * * 1,3,5", "UTC", "2024-01-01T09:00:00Z", "2024-01-03T08:30:00Z"},
+		{"weekday range", "0 20 * * 1-5", "UTC", "2024-01-05T21:00:00Z", "2024-01-08T20:00:00Z"},
+		{"sunday as 7", "0 10 * * 7", "UTC", "2024-01-06T12:00:00Z", "2024-01-07T10:00:00Z"},
+		{"sunday as 0", "0 10 * * 0", "UTC", "2024-01-06T12:00:00Z", "2024-01-07T10:00:00Z"},
+		{"day of month", "0 0 1 * *", "UTC", "2024-01-15T00:00:00Z", "2024-02-01T00:00:00Z"},
+		{"leap day", "0 12 29 2 *", "UTC", "2023-03-01T00:00:00Z", "2024-02-29T12:00:00Z"},
+		{"february 30", "0 0 30 2 *", "UTC", "2024-01-01T00:00:00Z", ""},
+		// Both days restricted, either matches: the 10th is a Tuesday
+		{"day of month or weekday", "0 12 10 * 5", "UTC", "2024-09-07T00:00:00Z", "2024-09-10T12:00:00Z"},
+		{"weekday or day of month", "0 12 10 * 5", "UTC", "2024-09-10T13:00:00Z", "2024-09-13T12:00:00Z"},
+		{"new year", "0 0 1 1 *", "UTC", "2024-06-01T00:00:00Z", "2025-01-01T00:00:00Z"},
+		{"in the time zone", "0 21 * * *", "America/Sao_Paulo", "2024-01-02T01:00:00Z", "2024-01-02T21:00:00-03:00"},
+		// 02:30 does not exist the day clocks go forward, that run is skipped
+		{"spring forward", "30 2 * * *", "America/New_York", "2024-03-09T03:00:00-05:00", "2024-03-11T02:30:00-04:00"},
+		{"spring forward hourly", "0 * * * *", "America/New_York", "2024-03-10T01:30:00-05:00", "2024-03-10T03:00:00-04:00"},
+		// 01:00 happens twice the day clocks go back, both run
+		{"fall back", "0 1 * * *", "America/New_York", "2024-11-03T01:30:00-04:00", "2024-11-03T01:00:00-05:00"},
+		{"fall back in Brazil", "30 23 * * *", "America/Sao_Paulo", "2019-02-16T23:45:00-02:00", "2019-02-16T23:30:00-03:00"},
+		// Midnight does not exist the day clocks go forward in Brazil
+		{"spring forward in Brazil", "0 0 * * *", "America/Sao_Paulo", "2018-11-03T12:00:00-03:00", "2018-11-05T00:00:00-02:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatalf("LoadLocation(%q): %v", tt.zone, err)
+			}
+			after, err := time.Parse(time.RFC3339, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+
+			got := cron.Next(after.In(loc))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %s, want no run", tt.after, got)
+				}
+				return
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vale-tudo-devs/tvbarrapesada/remotecontrol/pkg/models"
+)
+
+const (
+	defaultMissedGrace = 10 * time.Minute
+	checkInterval      = 5 * time.Second
+)
+
+// Scheduler fires the jobs added with /schedule when they are due. Jobs live
+// in Redis and survive restarts, a job missed by more than MissedGrace while
+// remotecontrol was down is skipped instead of firing late. Recurring jobs
+// are put back with their next run either way.
+type Scheduler struct {
+	MissedGrace time.Duration
+}
+
+// NewScheduler creates a Scheduler from the environment:
+// SCHEDULE_MISSED_GRACE (Go duration).
+func NewScheduler() (*Scheduler, error) {
+	s := &Scheduler{MissedGrace: defaultMissedGrace}
+
+	if v, ok := os.LookupEnv("SCHEDULE_MISSED_GRACE"); ok && v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SCHEDULE_MISSED_GRACE: %w", err)
+		}
+		s.MissedGrace = parsed
+	}
+	return s, nil
+}
+
+// Run fires due jobs until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	r, err := models.NewAuthenticatedRedisClient(ctx)
+	if err != nil {
+		log.Printf("Error creating redis client: %v", err)
+		return
+	}
+	r.Prefix = "channel"
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		s.fireDue(ctx, r)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) fireDue(ctx context.Context, r *models.RedisStore) {
+	now := time.Now()
+	// A job still leased once the grace is over was claimed by a scheduler
+	// that died, it is then skipped as missed and rescheduled
+	jobs, err := r.ClaimDueJobs(ctx, now, max(s.MissedGrace, time.Minute))
+	if err != nil {
+		log.Printf("Error claiming scheduled jobs: %v", err)
+	}
+
+	for _, job := range jobs {
+		if late := now.Sub(job.Next); late > s.MissedGrace {
+			log.Printf("Skipping scheduled job %s, missed by %s", job.ID, late.Round(time.Second))
+			notice(ctx, r, fmt.Sprintf("Missed the schedule of %s: %s, the bot was down", job.UserName, Describe(&job)))
+		} else {
+			s.fire(ctx, r, &job)
+		}
+		s.reschedule(ctx, r, &job, now)
+	}
+}
+
+// fire runs a job on behalf of whoever scheduled it, unless someone else
+// holds the DJ lock of their guild.
+func (s *Scheduler) fire(ctx context.Context, r *models.RedisStore, job *models.ScheduledJob) {
+	ctx = models.WithRequester(ctx, models.Requester{UserID: job.UserID, UserName: job.UserName, GuildID: job.GuildID})
+
+	if !job.Moderator {
+		lock, err := r.GetDJLock(ctx, job.GuildID)
+		if err != nil {
+			log.Printf("Error getting dj lock: %v", err)
+		}
+		if lock != nil && lock.UserID != job.UserID {
+			log.Printf("Skipping scheduled job %s, %s is the DJ", job.ID, lock.UserName)
+			notice(ctx, r, fmt.Sprintf("Skipped the schedule of %s: %s, %s is the DJ", job.UserName, Describe(job), lock.UserName))
+			return
+		}
+	}
+
+	state, err := r.GetPlayback(ctx)
+	if err != nil {
+		log.Printf("Error getting playback state: %v", err)
+	}
+
+	switch job.Action {
+	case models.ScheduleActionPlay:
+		if state != nil && state.Playing && state.ChannelID == job.ChannelID {
+			log.Printf("Scheduled job %s: %s already is on", job.ID, job.ChannelName)
+			return
+		}
+		note := "scheduled"
+		if job.Programme != "" {
+			note = fmt.Sprintf("scheduled for %s", job.Programme)
+		}
+		id, err := strconv.ParseInt(job.ChannelID, 10, 64)
+		if err == nil {
+			err = r.Play(models.WithHistoryNote(ctx, note), id)
+		}
+		if err != nil {
+			log.Printf("Error running scheduled job %s: %v", job.ID, err)
+			notice(ctx, r, fmt.Sprintf("Failed to run the schedule of %s: %s", job.UserName, Describe(job)))
+			return
+		}
+	case models.ScheduleActionStop:
+		if state != nil && !state.Playing {
+			return
+		}
+		if err := r.Stop(ctx); err != nil {
+			log.Printf("Error running scheduled job %s: %v", job.ID, err)
+			return
+		}
+	default:
+		log.Printf("Unknown scheduled job action: %s", job.Action)
+		return
+	}
+	log.Printf("Ran scheduled job %s: %s", job.ID, Describe(job))
+	notice(ctx, r, fmt.Sprintf("Scheduled by %s: %s", job.UserName, Describe(job)))
+}
+
+// reschedule puts a recurring job back with its next run after now and
+// deletes one-off jobs.
+func (s *Scheduler) reschedule(ctx context.Context, r *models.RedisStore, job *models.ScheduledJob, now time.Time) {
+	if job.Cron != "" {
+		next, err := NextRun(job, now)
+		if err != nil {
+			log.Printf("Error rescheduling job %s: %v", job.ID, err)
+		} else if !next.IsZero() {
+			job.Next = next
+			if err := r.SaveScheduledJob(ctx, job); err != nil {
+				log.Printf("Error rescheduling job %s: %v", job.ID, err)
+			}
+			return
+		}
+	}
+	if err := r.DeleteScheduledJob(ctx, job.ID); err != nil {
+		log.Printf("Error deleting scheduled job %s: %v", job.ID, err)
+	}
+}
+
+// NextRun returns when a recurring job runs next after the given time, in the
+// time zone of the job.
+func NextRun(job *models.ScheduledJob, after time.Time) (time.Time, error) {
+	cron, err := ParseCron(job.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := LoadLocation(job.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.Next(after.In(loc)), nil
+}
+
+// LoadLocation returns the named time zone, the one of the TZ environment
+// variable when the name is empty.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// Describe says what a job does, like "switch to 12 - ESPN for The Match".
+func Describe(job *models.ScheduledJob) string {
+	if job.Action == models.ScheduleActionStop {
+		if job.Programme != "" {
+			return fmt.Sprintf("turn the TV off after %s", job.Programme)
+		}
+		return "turn the TV off"
+	}
+	description := fmt.Sprintf("switch to %s - %s", job.ChannelID, job.ChannelName)
+	if job.Programme != "" {
+		description += fmt.Sprintf(" for %s", job.Programme)
+	}
+	return description
+}
+
+func notice(ctx context.Context, r *models.RedisStore, text string) {
+	if err := r.PublishNotice(ctx, text); err != nil {
+		log.Printf("Error publishing notice: %v", err)
+	}
+}
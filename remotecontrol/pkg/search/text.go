@@ -0,0 +1,87 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Shortest prefix indexed for prefix matching, one letter matches too much
+const MinPrefixLen = 2
+
+// Longest prefix indexed, longer query tokens fall back to trigram matching
+const MaxPrefixLen = 12
+
+// Fold removes accents and case from s, "São Paulo" becomes "sao paulo".
+func Fold(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// Tokens splits s into folded search tokens. Anything that is not a letter or
+// digit separates tokens and so does a change between letters and digits, so
+// "ESPN2" and "ESPN 2" both become ["espn", "2"].
+func Tokens(s string) []string {
+	var tokens []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, string(current))
+			current = current[:0]
+		}
+	}
+
+	for _, r := range Fold(s) {
+		switch {
+		case unicode.IsLetter(r):
+			if len(current) > 0 && unicode.IsDigit(current[len(current)-1]) {
+				flush()
+			}
+			current = append(current, r)
+		case unicode.IsDigit(r):
+			if len(current) > 0 && unicode.IsLetter(current[len(current)-1]) {
+				flush()
+			}
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// Prefixes returns the prefixes of token indexed for prefix matching, the
+// token itself excluded.
+func Prefixes(token string) []string {
+	runes := []rune(token)
+	var prefixes []string
+	for n := MinPrefixLen; n < len(runes) && n <= MaxPrefixLen; n++ {
+		prefixes = append(prefixes, string(runes[:n]))
+	}
+	return prefixes
+}
+
+// Trigrams returns the distinct trigrams of token, used to match words with
+// typos. Tokens shorter than three characters have none.
+func Trigrams(token string) []string {
+	runes := []rune(token)
+	seen := make(map[string]bool)
+	var trigrams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		t := string(runes[i : i+3])
+		if !seen[t] {
+			seen[t] = true
+			trigrams = append(trigrams, t)
+		}
+	}
+	return trigrams
+}
@@ -18,6 +18,14 @@ export default {
     hardwareAcceleratedDecoding: parseBoolean(process.env.STREAM_HARDWARE_ACCELERATION ?? 'false'),
     videoCodec: process.env.STREAM_VIDEO_CODEC ?? 'VP8',
 
+    // Commands options
+    consumerName: process.env.STREAMER_CONSUMER ?? 'streamer',
+    stopSettleMs: parseInt(process.env.STOP_SETTLE_MS ?? '2000'),
+
+    // Events options
+    heartbeatIntervalMs: parseInt(process.env.HEARTBEAT_INTERVAL_MS ?? '30000'),
+    startedGraceMs: parseInt(process.env.STARTED_GRACE_MS ?? '3000'),
+
     // Redis options
     redisHost: process.env.REDIS_HOST ?? (() => { throw new Error('REDIS_HOST is required'); })(),
     redisPort: parseInt(process.env.REDIS_PORT ?? (() => { throw new Error('REDIS_PORT is required'); })()),
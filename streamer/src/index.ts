@@ -2,7 +2,7 @@ import { StreamOptions, Utils } from "@dank074/discord-video-stream";
 import config from "./config.js";
 import { DiscordService } from "./services/discord.js";
 import { RedisService } from "./services/redis.js";
-import { RedisMessage } from "./types/types.js";
+import { RedisMessage, StreamOverrides, StreamerEvent } from "./types/types.js";
 import { ShutdownHandler } from "./utils/shutdown.js";
 import { YoutubeHelper } from "./utils/youtube.js";
 
@@ -42,25 +42,91 @@ const redisService = new RedisService();
 const shutdownHandler = new ShutdownHandler(discordService, redisService);
 shutdownHandler.setupShutdownHandlers();
 
-async function handlePlay(title: string, url: string) {
-    const videoUrl = await YoutubeHelper.getVideoInternalUrl(url) ?? url;
-    const streamUdpConn = await discordService.joinVoiceChannel(streamOpts);
-    discordService.setWatchingStatus(title);
-    await discordService.startStreaming(videoUrl, streamUdpConn);
-    console.log(videoUrl);
+// Bumped by every play and stop, a stream that ends after being replaced or
+// stopped must not report it
+let playGeneration = 0;
+let nowPlaying: { title: string, url: string } | null = null;
+
+async function publishEvent(event: Omit<StreamerEvent, "at">) {
+    await redisService.publish("tvbarrapesada:events", { ...event, at: new Date().toISOString() });
+}
+
+async function publishHeartbeat(boot: boolean) {
+    await publishEvent({
+        event: "heartbeat",
+        state: nowPlaying ? "playing" : "idle",
+        title: nowPlaying?.title,
+        url: nowPlaying?.url,
+        boot: boot || undefined,
+    });
+}
+
+function delay(ms: number) {
+    return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+function withOverrides(overrides: StreamOverrides | undefined): StreamOptions {
+    return {
+        ...streamOpts,
+        width: overrides?.width || streamOpts.width,
+        height: overrides?.height || streamOpts.height,
+        fps: overrides?.fps || streamOpts.fps,
+        bitrateKbps: overrides?.bitrate_kbps || streamOpts.bitrateKbps,
+    };
+}
+
+async function handlePlay(id: string | undefined, title: string, url: string, overrides?: StreamOverrides) {
+    const generation = ++playGeneration;
+    const current = () => generation === playGeneration;
+    try {
+        await publishEvent({ event: "buffering", id, command: "play", title, url });
+        const videoUrl = await YoutubeHelper.getVideoInternalUrl(url) ?? url;
+        const streamUdpConn = await discordService.joinVoiceChannel(withOverrides(overrides));
+        discordService.setWatchingStatus(title);
+        console.log(videoUrl);
+
+        // The stream only settles when it ends, it counts as started once it
+        // survived the grace period
+        let running = true;
+        const streaming = discordService.startStreaming(videoUrl, streamUdpConn).finally(() => { running = false; });
+        await Promise.race([streaming.catch(() => undefined), delay(config.startedGraceMs)]);
+        if (running && current()) {
+            nowPlaying = { title, url };
+            await publishEvent({ event: "started", id, command: "play", title, url });
+        }
+
+        await streaming;
+        if (current()) {
+            nowPlaying = null;
+            await publishEvent({ event: "ended", id, command: "play", title, url });
+        }
+    } catch (error) {
+        console.log("Error playing " + title + ": ", error);
+        if (current()) {
+            nowPlaying = null;
+            await publishEvent({ event: "error", id, command: "play", title, url, error: String(error) });
+        }
+    }
 }
 
 async function handleStop() {
+    playGeneration++;
+    nowPlaying = null;
     discordService.leaveVoiceChannel();
     discordService.setIdleStatus();
     console.log("Stopped playing");
+    // Commands are handled one at a time, give Discord time to release the
+    // stream before a play that may follow right away
+    await delay(config.stopSettleMs);
 }
 
-async function handleMessage({ command, title, url }: RedisMessage) {
+async function handleMessage({ command, title, url, id, options }: RedisMessage) {
     console.log("Received command: " + command + " from channel: " + title);
+    await publishEvent({ event: "ack", id, command, title, url });
 
     if (command === "play") {
-        await handlePlay(title, url);
+        // Not awaited, it only settles when the stream ends
+        handlePlay(id, title, url, options);
     }
 
     if (command === "stop") {
@@ -72,4 +138,35 @@ async function handleMessage({ command, title, url }: RedisMessage) {
     }
 }
 
-redisService.subscribe("tvbarrapesada", handleMessage);
\ No newline at end of file
+async function handleCommand(message: RedisMessage) {
+    if (message.expires_at && Date.parse(message.expires_at) < Date.now()) {
+        console.log("Dropping expired command: " + message.command);
+        await publishEvent({ event: "error", id: message.id, command: message.command, title: message.title, url: message.url, error: "command expired" });
+        return;
+    }
+    await handleMessage(message);
+}
+
+// Commands sent while the streamer was down are superseded by the desired
+// state, the last play or stop requested, which is all that is replayed
+async function handleBacklog(messages: RedisMessage[]) {
+    const desired = await redisService.get<RedisMessage>("tvbarrapesada:desired");
+    for (const message of messages) {
+        if (message.id && message.id !== desired?.id) {
+            await publishEvent({ event: "error", id: message.id, command: message.command, error: "superseded by a newer command" });
+        }
+    }
+
+    if (desired?.command === "play") {
+        console.log("Replaying desired state: " + desired.title);
+        await handleMessage(desired);
+    }
+}
+
+// Remotecontrol learns the streamer is up, and back after a restart, from
+// the heartbeats. Commands are only consumed once Discord is ready to stream.
+discordService.onReady(async () => {
+    await publishHeartbeat(true);
+    setInterval(() => publishHeartbeat(false), config.heartbeatIntervalMs);
+    redisService.consume("tvbarrapesada:commands", "streamer", config.consumerName, handleCommand, handleBacklog);
+});
@@ -20,6 +20,10 @@ export class DiscordService {
         });
     }
 
+    public onReady(listener: () => void) {
+        this.streamer.client.once("ready", listener);
+    }
+
     private createCustomStatus(emoji: string, state: string): CustomStatus {
         return new CustomStatus(this.streamer.client).setEmoji(emoji).setState(state);
     }
@@ -1,42 +1,122 @@
 import { Redis } from 'ioredis';
 import config from '../config.js';
-import { RedisMessage } from '../types/types.js';
+import { RedisMessage, StreamerEvent } from '../types/types.js';
+
+// Entries read at a time from the commands stream
+const READ_COUNT = 10;
+// How long a read waits for new commands before trying again (ms)
+const BLOCK_MS = 5000;
 
 export class RedisService {
+    // Blocking stream reads hold their connection, everything else goes
+    // through the publisher
     private redis: Redis;
+    private publisher: Redis;
 
     constructor() {
-        this.redis = new Redis({
+        const options = {
             host: config.redisHost,
             port: config.redisPort,
             password: config.redisPassword
-        });
+        };
+        this.redis = new Redis(options);
+        this.publisher = new Redis(options);
     }
 
-    public async subscribe(pubSubChannel: string, messageHandler: (message: RedisMessage) => Promise<void>) {
-        this.redis.subscribe(pubSubChannel, (err) => {
-            if (err) {
-                console.error('Failed to subscribe to Redis channel:', err);
+    /**
+     * Consumes the commands stream through a consumer group. Entries are acknowledged before
+     * being handled, a command that crashes the streamer is not delivered again, the desired
+     * state covers it. Whatever was waiting when the consumer starts is handed to backlogHandler
+     * at once, then new commands are handed one by one to messageHandler.
+     */
+    public async consume(
+        stream: string,
+        group: string,
+        consumer: string,
+        messageHandler: (message: RedisMessage) => Promise<void>,
+        backlogHandler: (messages: RedisMessage[]) => Promise<void>,
+    ) {
+        try {
+            await this.publisher.xgroup('CREATE', stream, group, '$', 'MKSTREAM');
+        } catch (error) {
+            if (!String(error).includes('BUSYGROUP')) {
+                console.error('Failed to create Redis consumer group:', error);
                 return;
             }
-            console.log(`Subscribed to Redis channel: ${pubSubChannel}`);
-        });
-
-        this.redis.on('message', async (receivedChannel: string, message: string) => {
-            if (receivedChannel === pubSubChannel) {
-                try {
-                    console.log("Received message: " + message);
-                    const parsedMessage = JSON.parse(message) as RedisMessage;
-                    console.log(parsedMessage);
-                    await messageHandler(parsedMessage);
-                } catch (error) {
-                    console.error('Error processing Redis message:', error);
+        }
+        console.log(`Consuming Redis stream: ${stream} as ${group}/${consumer}`);
+
+        // Entries delivered before a crash ("0") and the ones sent while down (">")
+        const backlog: RedisMessage[] = [];
+        for (const from of ['0', '>']) {
+            for (;;) {
+                const messages = await this.read(stream, group, consumer, from, false);
+                if (messages.length === 0) {
+                    break;
+                }
+                backlog.push(...messages);
+                if (from === '0') {
+                    break;
+                }
+            }
+        }
+        await backlogHandler(backlog);
+
+        for (;;) {
+            try {
+                for (const message of await this.read(stream, group, consumer, '>', true)) {
+                    await messageHandler(message);
                 }
+            } catch (error) {
+                console.error('Error processing Redis stream:', error);
+                await new Promise((resolve) => setTimeout(resolve, BLOCK_MS));
+            }
+        }
+    }
+
+    private async read(stream: string, group: string, consumer: string, from: string, block: boolean): Promise<RedisMessage[]> {
+        const args: (string | number)[] = ['GROUP', group, consumer, 'COUNT', READ_COUNT];
+        if (block) {
+            args.push('BLOCK', BLOCK_MS);
+        }
+        args.push('STREAMS', stream, from);
+
+        const reply = await this.redis.call('XREADGROUP', ...args) as [string, [string, string[]][]][] | null;
+        const entries = reply?.[0]?.[1] ?? [];
+
+        const messages: RedisMessage[] = [];
+        for (const [id, fields] of entries) {
+            await this.publisher.xack(stream, group, id);
+            const index = fields.indexOf('payload');
+            if (index < 0) {
+                continue;
+            }
+            const payload = fields[index + 1];
+            try {
+                console.log("Received message: " + payload);
+                messages.push(JSON.parse(payload) as RedisMessage);
+            } catch (error) {
+                console.error('Error parsing Redis stream entry ' + id + ':', error);
             }
-        });
+        }
+        return messages;
+    }
+
+    public async get<T>(key: string): Promise<T | null> {
+        const value = await this.publisher.get(key);
+        return value ? JSON.parse(value) as T : null;
+    }
+
+    public async publish(pubSubChannel: string, event: StreamerEvent) {
+        try {
+            await this.publisher.publish(pubSubChannel, JSON.stringify(event));
+        } catch (error) {
+            console.error('Failed to publish Redis event:', error);
+        }
     }
 
     public disconnect() {
         this.redis.disconnect();
+        this.publisher.disconnect();
     }
 }
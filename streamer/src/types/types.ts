@@ -2,4 +2,32 @@ export interface RedisMessage {
     command: string;
     title: string;
     url: string;
-}
\ No newline at end of file
+    // Correlation ID, echoed back in the events about this command
+    id?: string;
+    // Commands not handled by then are dropped
+    expires_at?: string;
+    // Play only: overrides of the stream options from the config
+    options?: StreamOverrides;
+}
+
+export interface StreamOverrides {
+    width?: number;
+    height?: number;
+    fps?: number;
+    bitrate_kbps?: number;
+}
+
+export type StreamerEventType = "ack" | "started" | "buffering" | "ended" | "error" | "heartbeat";
+
+export interface StreamerEvent {
+    event: StreamerEventType;
+    id?: string;
+    command?: string;
+    title?: string;
+    url?: string;
+    error?: string;
+    // Heartbeats only: what the streamer is doing and whether it just booted
+    state?: "idle" | "playing";
+    boot?: boolean;
+    at: string;
+}